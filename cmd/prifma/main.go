@@ -2,13 +2,21 @@ package main
 
 import (
 	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/prifma/access"
 	"github.com/topvisor/go-prifma/pkg/prifma/accesslog"
+	"github.com/topvisor/go-prifma/pkg/prifma/authrequest"
 	"github.com/topvisor/go-prifma/pkg/prifma/basicauth"
 	"github.com/topvisor/go-prifma/pkg/prifma/blockreq"
 	"github.com/topvisor/go-prifma/pkg/prifma/dumplog"
+	"github.com/topvisor/go-prifma/pkg/prifma/exposeip"
+	"github.com/topvisor/go-prifma/pkg/prifma/hosts"
 	"github.com/topvisor/go-prifma/pkg/prifma/http"
+	"github.com/topvisor/go-prifma/pkg/prifma/jwtauth"
+	"github.com/topvisor/go-prifma/pkg/prifma/limitoutgoing"
+	"github.com/topvisor/go-prifma/pkg/prifma/outgoingiface"
 	"github.com/topvisor/go-prifma/pkg/prifma/outgoingip"
 	"github.com/topvisor/go-prifma/pkg/prifma/proxyreq"
+	"github.com/topvisor/go-prifma/pkg/prifma/resolver"
 	"github.com/topvisor/go-prifma/pkg/prifma/tunnel"
 	"github.com/topvisor/go-prifma/pkg/prifma/useipheader"
 )
@@ -32,9 +40,17 @@ func start(configFilename string) error {
 	server := prifma.NewServer(
 		dumplog.New(),
 		blockreq.New(),
+		access.New(),
 		basicauth.New(),
+		jwtauth.New(),
+		resolver.New(),
+		hosts.New(),
 		outgoingip.New(),
+		outgoingiface.New(),
+		exposeip.New(),
 		useipheader.New(),
+		authrequest.New(),
+		limitoutgoing.New(),
 		proxyreq.New(),
 		accesslog.New(),
 		tunnel.New(),
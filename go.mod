@@ -4,6 +4,8 @@ go 1.13
 
 require (
 	github.com/abbot/go-http-auth v0.4.1-0.20181019201920-860ed7f246ff
+	github.com/golang-jwt/jwt v3.2.2+incompatible
+	github.com/oschwald/maxminddb-golang v1.3.1
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
 	golang.org/x/net v0.0.0-20191014212845-da9a3fd4c582
 )
@@ -0,0 +1,12 @@
+package prifma
+
+// Access is a decision about the request access made by access and auth modules
+type Access byte
+
+const (
+	AccessUndefined Access = iota
+	// AccessGranted - the request is allowed by ip ("satisfy any") or authentication
+	AccessGranted
+	// AccessDenied - the request is denied by ip, but it still can be allowed by authentication ("satisfy any")
+	AccessDenied
+)
@@ -0,0 +1,153 @@
+package access
+
+import (
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	ModuleDirectiveAllow   = "allow"
+	ModuleDirectiveDeny    = "deny"
+	ModuleDirectiveSatisfy = "satisfy"
+)
+
+type Rule struct {
+	Allow bool
+	Net   *net.IPNet // nil - all addresses
+}
+
+type Access struct {
+	Rules      []Rule
+	SatisfyAny bool
+	Inherited  bool
+}
+
+func New() *Access {
+	return &Access{
+		Rules: make([]Rule, 0),
+	}
+}
+
+// HandleRequest checks rules in order, the first matched rule is applied.
+// With "satisfy any" the decision is passed to auth modules.
+func (t *Access) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	if len(t.Rules) == 0 {
+		return result, nil
+	}
+
+	ip := net.ParseIP(utils.GetHostname(result.GetRequest().RemoteAddr))
+
+	for _, rule := range t.Rules {
+		if rule.Net != nil && (ip == nil || !rule.Net.Contains(ip)) {
+			continue
+		}
+
+		switch true {
+		case rule.Allow && t.SatisfyAny:
+			result.SetAccess(prifma.AccessGranted)
+		case !rule.Allow && t.SatisfyAny:
+			result.SetAccess(prifma.AccessDenied)
+		case !rule.Allow:
+			result.SetAccess(prifma.AccessDenied)
+			result.SetResponse(prifma.NewResponseError(http.StatusForbidden, ""))
+		}
+
+		break
+	}
+
+	return result, nil
+}
+
+func (t *Access) AddRule(allow bool, addr string) error {
+	rule := Rule{Allow: allow}
+
+	if addr != "all" {
+		cidr := addr
+		if !strings.ContainsRune(addr, '/') {
+			if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("wrong address - '%s'", addr)
+		}
+
+		rule.Net = ipNet
+	}
+
+	// rules of the parent context are replaced by the rules of the condition
+	if t.Inherited {
+		t.Rules = make([]Rule, 0)
+		t.Inherited = false
+	}
+
+	t.Rules = append(t.Rules[:len(t.Rules):len(t.Rules)], rule)
+
+	return nil
+}
+
+func (t *Access) SetSatisfy(satisfy string) error {
+	switch satisfy {
+	case "any":
+		t.SatisfyAny = true
+	case "all":
+		t.SatisfyAny = false
+	default:
+		return fmt.Errorf("wrong satisfy - '%s'", satisfy)
+	}
+
+	return nil
+}
+
+func (t *Access) GetDirective() string {
+	return ModuleDirectiveAllow
+}
+
+func (t *Access) GetDirectives() []string {
+	return []string{ModuleDirectiveAllow, ModuleDirectiveDeny, ModuleDirectiveSatisfy}
+}
+
+func (t *Access) Clone() prifma.Module {
+	clone := *t
+	clone.Inherited = true
+
+	return &clone
+}
+
+func (t *Access) Call(command conf.Command) (err error) {
+	if len(command.GetArgs()) != 1 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	arg := command.GetArgs()[0]
+
+	switch command.GetName() {
+	case ModuleDirectiveAllow:
+		err = t.AddRule(true, arg)
+	case ModuleDirectiveDeny:
+		err = t.AddRule(false, arg)
+	case ModuleDirectiveSatisfy:
+		err = t.SetSatisfy(arg)
+	default:
+		return conf.NewErrCommandName(command)
+	}
+
+	if err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *Access) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
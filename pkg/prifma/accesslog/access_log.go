@@ -46,8 +46,13 @@ func (t *AccessLog) AfterWriteResponse(req *http.Request, resp prifma.Response)
 		user = username
 	}
 
+	var sni string
+	if serverName := prifma.GetServerName(req); serverName != "" {
+		sni = " sni/" + serverName
+	}
+
 	t.Logger.Printf(
-		"%s %d %s %s %v l/%v r/%v\n",
+		"%s %d %s %s %v l/%v r/%v%s\n",
 		req.RemoteAddr,
 		resp.GetCode(),
 		req.Method,
@@ -55,6 +60,7 @@ func (t *AccessLog) AfterWriteResponse(req *http.Request, resp prifma.Response)
 		user,
 		resp.GetLAddr(),
 		resp.GetRAddr(),
+		sni,
 	)
 
 	return nil
@@ -0,0 +1,245 @@
+package authrequest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/prifma/basicauth"
+	"github.com/topvisor/go-prifma/pkg/prifma/outgoingip"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ModuleDirective = "auth_request"
+
+	HeaderUser         = "X-Prifma-User"
+	HeaderPasswordHash = "X-Prifma-Password-Hash"
+	HeaderClientIp     = "X-Prifma-Client-Ip"
+	HeaderDestination  = "X-Prifma-Destination"
+	HeaderOutgoingPool = "X-Prifma-Outgoing-Pool"
+
+	DefaultCacheTtl = time.Minute
+	DefaultTimeout  = time.Second * 5
+)
+
+type AuthRequest struct {
+	Url    *url.URL
+	Client *http.Client
+	Cache  *Cache
+}
+
+func New() *AuthRequest {
+	return new(AuthRequest)
+}
+
+func (t *AuthRequest) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	if t.Url == nil || result.GetAccess() == prifma.AccessGranted {
+		return result, nil
+	}
+
+	req := result.GetRequest()
+	user, pass, _ := utils.ProxyBasicAuth(req)
+	passHash := sha256.Sum256([]byte(pass))
+
+	authReq := &http.Request{
+		Method: http.MethodGet,
+		URL:    t.Url,
+		Header: make(http.Header),
+		Host:   t.Url.Host,
+	}
+
+	authReq.Header.Set(HeaderUser, user)
+	authReq.Header.Set(HeaderPasswordHash, hex.EncodeToString(passHash[:]))
+	authReq.Header.Set(HeaderClientIp, utils.GetHostname(req.RemoteAddr))
+	authReq.Header.Set(HeaderDestination, req.Host)
+
+	key := strings.Join([]string{
+		authReq.Header.Get(HeaderUser),
+		authReq.Header.Get(HeaderPasswordHash),
+		authReq.Header.Get(HeaderClientIp),
+		authReq.Header.Get(HeaderDestination),
+	}, "\x00")
+
+	decision, ok := t.Cache.Get(key)
+	if !ok {
+		var err error
+		if decision, err = t.Request(authReq.WithContext(req.Context())); err != nil {
+			result.SetResponse(prifma.NewResponseError(http.StatusInternalServerError, "auth request failed"))
+
+			return result, err
+		}
+
+		t.Cache.Set(key, decision)
+	}
+
+	if !decision.Allowed {
+		result.SetResponse(basicauth.NewResponseRequireAuth(req))
+
+		return result, nil
+	}
+
+	result.SetAccess(prifma.AccessGranted)
+
+	return t.ApplyHeader(result, decision.Header)
+}
+
+func (t *AuthRequest) Request(req *http.Request) (*Decision, error) {
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth request failed: %v", err)
+	}
+
+	utils.CloseFile(resp.Body)
+
+	switch true {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return &Decision{Allowed: true, Header: resp.Header}, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return &Decision{Allowed: false}, nil
+	}
+
+	return nil, fmt.Errorf("auth request failed: unexpected status %d", resp.StatusCode)
+}
+
+// ApplyHeader applies headers returned by the auth service
+func (t *AuthRequest) ApplyHeader(result prifma.HandleRequestResult, header http.Header) (prifma.HandleRequestResult, error) {
+	if ipsStr := header.Get(prifma.HeaderOutgoingIp); ipsStr != "" {
+		var ipV4, ipV6 net.IP
+
+		for _, ipStr := range strings.Split(ipsStr, ",") {
+			ip := net.ParseIP(strings.TrimSpace(ipStr))
+			if ip == nil {
+				return result, fmt.Errorf("auth request returned wrong outgoing ip: '%s'", ipStr)
+			}
+
+			if ip.To4() != nil {
+				ipV4 = ip
+			} else {
+				ipV6 = ip
+			}
+		}
+
+		// ips of the address family not returned by the service are kept
+		if ipV4 != nil {
+			result.GetDialer().SetIpV4(ipV4)
+		}
+		if ipV6 != nil {
+			result.GetDialer().SetIpV6(ipV6)
+		}
+		if ipV4 != nil && ipV6 != nil {
+			result.GetDialer().SetRandomIp(false)
+		}
+
+		outgoingip.FixIps(result)
+	}
+
+	if poolName := header.Get(HeaderOutgoingPool); poolName != "" {
+		pool, err := outgoingip.DefaultPools.Get(poolName)
+		if err != nil {
+			return result, fmt.Errorf("auth request returned wrong outgoing pool: %v", err)
+		}
+
+		if err = outgoingip.ApplyPool(result, pool); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (t *AuthRequest) Off() error {
+	t.Url = nil
+	t.Client = nil
+	t.Cache = nil
+
+	return nil
+}
+
+func (t *AuthRequest) SetUrl(urlStr string) error {
+	uri, err := url.Parse(urlStr)
+	if err != nil || uri.Host == "" {
+		return fmt.Errorf("wrong auth request url - '%s'", urlStr)
+	}
+
+	t.Url = uri
+	t.Client = &http.Client{Timeout: DefaultTimeout}
+	t.Cache = NewCache(DefaultCacheTtl)
+
+	return nil
+}
+
+func (t *AuthRequest) SetCacheTtl(ttl string) error {
+	dur, err := time.ParseDuration(ttl)
+	if err != nil {
+		return fmt.Errorf("invalid cache ttl - %s", ttl)
+	}
+
+	t.Cache = NewCache(dur)
+
+	return nil
+}
+
+func (t *AuthRequest) SetTimeout(timeout string) error {
+	dur, err := time.ParseDuration(timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout - %s", timeout)
+	}
+
+	t.Client = &http.Client{Timeout: dur}
+
+	return nil
+}
+
+func (t *AuthRequest) GetDirective() string {
+	return ModuleDirective
+}
+
+func (t *AuthRequest) Clone() prifma.Module {
+	clone := *t
+
+	return &clone
+}
+
+func (t *AuthRequest) Call(command conf.Command) (err error) {
+	if command.GetName() != ModuleDirective {
+		return conf.NewErrCommandName(command)
+	}
+
+	if len(command.GetArgs()) != 1 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	arg := command.GetArgs()[0]
+	if arg == "off" {
+		return t.Off()
+	}
+
+	if err = t.SetUrl(arg); err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *AuthRequest) CallBlock(command conf.Command) (conf.Block, error) {
+	if command.GetName() != ModuleDirective {
+		return nil, conf.NewErrCommandName(command)
+	}
+
+	if len(command.GetArgs()) != 1 {
+		return nil, conf.NewErrCommandArgsNumber(command)
+	}
+
+	if err := t.SetUrl(command.GetArgs()[0]); err != nil {
+		return nil, conf.NewErrCommand(command, err.Error())
+	}
+
+	return NewConfBlock(t), nil
+}
@@ -0,0 +1,71 @@
+package authrequest
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Decision struct {
+	Allowed bool
+	Header  http.Header
+}
+
+type CacheItem struct {
+	Decision *Decision
+	Expires  time.Time
+}
+
+type Cache struct {
+	Ttl       time.Duration
+	Items     map[string]CacheItem
+	LastSweep time.Time
+	Mutex     *sync.Mutex
+}
+
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		Ttl:       ttl,
+		Items:     make(map[string]CacheItem),
+		LastSweep: time.Now(),
+		Mutex:     new(sync.Mutex),
+	}
+}
+
+func (t *Cache) Get(key string) (*Decision, bool) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	item, ok := t.Items[key]
+	if !ok || time.Now().After(item.Expires) {
+		return nil, false
+	}
+
+	return item.Decision, true
+}
+
+func (t *Cache) Set(key string, decision *Decision) {
+	if t.Ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	if now.Sub(t.LastSweep) > t.Ttl {
+		for k, item := range t.Items {
+			if now.After(item.Expires) {
+				delete(t.Items, k)
+			}
+		}
+
+		t.LastSweep = now
+	}
+
+	t.Items[key] = CacheItem{
+		Decision: decision,
+		Expires:  now.Add(t.Ttl),
+	}
+}
@@ -0,0 +1,47 @@
+package authrequest
+
+import (
+	"github.com/topvisor/go-prifma/pkg/conf"
+)
+
+const (
+	ModuleBlockDirectiveCacheTtl = "cache_ttl"
+	ModuleBlockDirectiveTimeout  = "timeout"
+)
+
+type ConfBlock struct {
+	AuthRequest *AuthRequest
+}
+
+func NewConfBlock(authRequest *AuthRequest) *ConfBlock {
+	return &ConfBlock{
+		AuthRequest: authRequest,
+	}
+}
+
+func (t *ConfBlock) Call(command conf.Command) (err error) {
+	if len(command.GetArgs()) != 1 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	arg := command.GetArgs()[0]
+
+	switch command.GetName() {
+	case ModuleBlockDirectiveCacheTtl:
+		err = t.AuthRequest.SetCacheTtl(arg)
+	case ModuleBlockDirectiveTimeout:
+		err = t.AuthRequest.SetTimeout(arg)
+	default:
+		return conf.NewErrCommandName(command)
+	}
+
+	if err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *ConfBlock) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
@@ -1,66 +1,182 @@
 package basicauth
 
 import (
-	"encoding/csv"
 	"fmt"
-	auth "github.com/abbot/go-http-auth"
 	"github.com/topvisor/go-prifma/pkg/conf"
 	"github.com/topvisor/go-prifma/pkg/prifma"
 	"github.com/topvisor/go-prifma/pkg/utils"
-	"os"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
 )
 
-const ModuleDirective = "basic_auth"
+const (
+	ModuleDirective        = "basic_auth"
+	ModuleDirectiveLockout = "basic_auth_lockout"
+	ModuleDirectiveFailLog = "basic_auth_fail_log"
+)
 
 type BasicAuth struct {
-	Users map[string]string
+	Htpasswd      *Htpasswd
+	Failures      *Failures
+	IpThreshold   int
+	UserThreshold int
+	LockoutTime   time.Duration
+	FailLog       *log.Logger
+	Modules       []prifma.Module
 }
 
 func New() *BasicAuth {
-	return new(BasicAuth)
+	return &BasicAuth{
+		Failures: NewFailures(),
+	}
 }
 
 func (t *BasicAuth) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
-	if t.Users == nil {
+	if t.Htpasswd == nil || result.GetAccess() == prifma.AccessGranted {
 		return result, nil
 	}
 
-	user, pass, _ := utils.ProxyBasicAuth(result.GetRequest())
-	secret, ok := t.Users[user]
-	if !ok || !auth.CheckSecret(pass, secret) {
-		result.SetResponse(NewResponseRequireAuth(result.GetRequest()))
+	req := result.GetRequest()
+	ip := utils.GetHostname(req.RemoteAddr)
+	user, pass, ok := utils.ProxyBasicAuth(req)
+
+	if t.IsLocked(ip, user) {
+		prifma.Metrics.Add("auth_locked_requests", 1)
+		t.LogFailure(ip, user, "locked")
+		result.SetResponse(prifma.NewResponseError(http.StatusTooManyRequests, ""))
+
+		return result, t.Htpasswd.PopError()
+	}
+
+	if t.Htpasswd.CheckUser(user, pass) {
+		result.SetAccess(prifma.AccessGranted)
+
+		if t.UserThreshold > 0 {
+			t.Failures.Reset("user " + user)
+		}
+	} else if t.IsJwtDeferred(req) {
+		// the token is checked by "jwt_auth"
+		return result, t.Htpasswd.PopError()
+	} else {
+		if ok {
+			t.AddFailure(ip, user, "wrong password")
+		}
+
+		result.SetResponse(NewResponseRequireAuth(req))
+	}
+
+	return result, t.Htpasswd.PopError()
+}
+
+// IsJwtDeferred returns true if the request has the bearer token and "jwt_auth" of the context is enabled
+func (t *BasicAuth) IsJwtDeferred(req *http.Request) bool {
+	_, ok := utils.ProxyBearerToken(req)
+
+	return ok && prifma.GetJwtVerifier(t.Modules) != nil
+}
+
+func (t *BasicAuth) IsLocked(ip string, user string) bool {
+	if t.LockoutTime == 0 {
+		return false
+	}
+
+	return t.IpThreshold > 0 && t.Failures.IsLocked("ip "+ip) ||
+		t.UserThreshold > 0 && user != "" && t.Failures.IsLocked("user "+user)
+}
+
+// AddFailure counts the failure of the ip and the user (if not empty)
+func (t *BasicAuth) AddFailure(ip string, user string, reason string) {
+	prifma.Metrics.Add("auth_failures", 1)
+	t.LogFailure(ip, user, reason)
+
+	if t.LockoutTime == 0 {
+		return
 	}
 
-	return result, nil
+	if t.IpThreshold > 0 && t.Failures.Add("ip "+ip, t.IpThreshold, t.LockoutTime) {
+		prifma.Metrics.Add("auth_lockouts", 1)
+		t.LogFailure(ip, user, "ip locked for "+t.LockoutTime.String())
+	}
+	if t.UserThreshold > 0 && user != "" && t.Failures.Add("user "+user, t.UserThreshold, t.LockoutTime) {
+		prifma.Metrics.Add("auth_lockouts", 1)
+		t.LogFailure(ip, user, "user locked for "+t.LockoutTime.String())
+	}
+}
+
+func (t *BasicAuth) LogFailure(ip string, user string, reason string) {
+	if t.FailLog != nil {
+		t.FailLog.Printf("%s %s %s\n", ip, user, reason)
+	}
+}
+
+func (t *BasicAuth) SetContextModules(modules []prifma.Module) {
+	t.Modules = modules
 }
 
 func (t *BasicAuth) Off() error {
-	t.Users = nil
+	t.Htpasswd = nil
 
 	return nil
 }
 
 func (t *BasicAuth) LoadHtpasswdFile(filename string) error {
-	file, err := os.Open(filename)
+	htpasswd, err := LoadHtpasswd(filename)
 	if err != nil {
-		return fmt.Errorf("can't open htpasswd file: '%s'", filename)
+		return err
 	}
 
-	reader := csv.NewReader(file)
-	reader.Comma = ':'
-	reader.Comment = '#'
-	reader.TrimLeadingSpace = true
+	t.Htpasswd = htpasswd
 
-	records, err := reader.ReadAll()
-	if err != nil {
-		return fmt.Errorf("wrong format of htpasswd file: '%s'", filename)
+	return nil
+}
+
+func (t *BasicAuth) LockoutOff() error {
+	t.IpThreshold = 0
+	t.UserThreshold = 0
+	t.LockoutTime = 0
+
+	return nil
+}
+
+func (t *BasicAuth) SetLockout(ipThreshold string, userThreshold string, lockoutTime string) error {
+	ipThresholdInt, err := strconv.Atoi(ipThreshold)
+	if err != nil || ipThresholdInt < 0 {
+		return fmt.Errorf("invalid ip threshold - %s", ipThreshold)
 	}
 
-	t.Users = make(map[string]string)
-	for _, record := range records {
-		t.Users[record[0]] = record[1]
+	userThresholdInt, err := strconv.Atoi(userThreshold)
+	if err != nil || userThresholdInt < 0 {
+		return fmt.Errorf("invalid user threshold - %s", userThreshold)
+	}
+
+	dur, err := time.ParseDuration(lockoutTime)
+	if err != nil || dur <= 0 {
+		return fmt.Errorf("invalid lockout time - %s", lockoutTime)
+	}
+
+	t.IpThreshold = ipThresholdInt
+	t.UserThreshold = userThresholdInt
+	t.LockoutTime = dur
+
+	return nil
+}
+
+func (t *BasicAuth) FailLogOff() error {
+	t.FailLog = nil
+
+	return nil
+}
+
+func (t *BasicAuth) SetFailLogFilename(filename string) error {
+	file, err := utils.OpenOrCreateFile(filename)
+	if err != nil {
+		return fmt.Errorf("can't open auth fail log file: '%s'", filename)
 	}
 
+	t.FailLog = log.New(file, "", log.Ldate|log.Ltime|log.Lmicroseconds)
+
 	return nil
 }
 
@@ -68,27 +184,59 @@ func (t *BasicAuth) GetDirective() string {
 	return ModuleDirective
 }
 
+func (t *BasicAuth) GetDirectives() []string {
+	return []string{ModuleDirective, ModuleDirectiveLockout, ModuleDirectiveFailLog}
+}
+
 func (t *BasicAuth) Clone() prifma.Module {
 	clone := *t
 
 	return &clone
 }
 
-func (t *BasicAuth) Call(command conf.Command) error {
-	if command.GetName() != ModuleDirective {
+func (t *BasicAuth) Call(command conf.Command) (err error) {
+	args := command.GetArgs()
+
+	switch command.GetName() {
+	case ModuleDirective:
+		if len(args) != 1 {
+			return conf.NewErrCommandArgsNumber(command)
+		}
+
+		if args[0] == "off" {
+			return t.Off()
+		}
+
+		err = t.LoadHtpasswdFile(args[0])
+	case ModuleDirectiveLockout:
+		if len(args) == 1 && args[0] == "off" {
+			return t.LockoutOff()
+		}
+
+		if len(args) != 3 {
+			return conf.NewErrCommandArgsNumber(command)
+		}
+
+		err = t.SetLockout(args[0], args[1], args[2])
+	case ModuleDirectiveFailLog:
+		if len(args) != 1 {
+			return conf.NewErrCommandArgsNumber(command)
+		}
+
+		if args[0] == "off" {
+			return t.FailLogOff()
+		}
+
+		err = t.SetFailLogFilename(args[0])
+	default:
 		return conf.NewErrCommandName(command)
 	}
 
-	if len(command.GetArgs()) != 1 {
-		return conf.NewErrCommandArgsNumber(command)
-	}
-
-	arg := command.GetArgs()[0]
-	if arg == "off" {
-		return t.Off()
+	if err != nil {
+		err = conf.NewErrCommand(command, err.Error())
 	}
 
-	return t.LoadHtpasswdFile(arg)
+	return err
 }
 
 func (t *BasicAuth) CallBlock(command conf.Command) (conf.Block, error) {
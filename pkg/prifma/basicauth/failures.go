@@ -0,0 +1,85 @@
+package basicauth
+
+import (
+	"sync"
+	"time"
+)
+
+type FailuresItem struct {
+	Count       int
+	Last        time.Time
+	LockedUntil time.Time
+}
+
+// Failures counts authentication failures by key (client ip or username).
+// The counter is reset if there were no failures during the lockout time.
+type Failures struct {
+	Items     map[string]*FailuresItem
+	LastSweep time.Time
+	Mutex     *sync.Mutex
+}
+
+func NewFailures() *Failures {
+	return &Failures{
+		Items:     make(map[string]*FailuresItem),
+		LastSweep: time.Now(),
+		Mutex:     new(sync.Mutex),
+	}
+}
+
+func (t *Failures) IsLocked(key string) bool {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	item, ok := t.Items[key]
+
+	return ok && time.Now().Before(item.LockedUntil)
+}
+
+// Add counts the failure and returns true if the key has been locked
+func (t *Failures) Add(key string, threshold int, lockoutTime time.Duration) bool {
+	now := time.Now()
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.sweep(now, lockoutTime)
+
+	item, ok := t.Items[key]
+	if !ok || now.Sub(item.Last) > lockoutTime {
+		item = new(FailuresItem)
+		t.Items[key] = item
+	}
+
+	item.Count++
+	item.Last = now
+
+	if item.Count < threshold {
+		return false
+	}
+
+	item.Count = 0
+	item.LockedUntil = now.Add(lockoutTime)
+
+	return true
+}
+
+func (t *Failures) Reset(key string) {
+	t.Mutex.Lock()
+	delete(t.Items, key)
+	t.Mutex.Unlock()
+}
+
+func (t *Failures) sweep(now time.Time, lockoutTime time.Duration) {
+	if now.Sub(t.LastSweep) < lockoutTime {
+		return
+	}
+
+	for key, item := range t.Items {
+		if now.Sub(item.Last) > lockoutTime && now.After(item.LockedUntil) {
+			delete(t.Items, key)
+		}
+	}
+
+	t.LastSweep = now
+}
@@ -0,0 +1,76 @@
+package basicauth
+
+import (
+	"encoding/csv"
+	"fmt"
+	auth "github.com/abbot/go-http-auth"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"os"
+	"sync"
+)
+
+// Htpasswd keeps users of htpasswd file, the file is reloaded on change.
+// If the changed file can't be loaded, previous users are kept.
+type Htpasswd struct {
+	Users   map[string]string
+	RWMutex *sync.RWMutex
+	Watcher *utils.FileWatcher
+}
+
+func LoadHtpasswd(filename string) (*Htpasswd, error) {
+	t := &Htpasswd{
+		RWMutex: new(sync.RWMutex),
+	}
+
+	watcher, err := utils.WatchFile(filename, t.Load)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Watcher = watcher
+
+	return t, nil
+}
+
+func (t *Htpasswd) Load(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("can't open htpasswd file: '%s'", filename)
+	}
+
+	defer utils.CloseFile(file)
+
+	reader := csv.NewReader(file)
+	reader.Comma = ':'
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("wrong format of htpasswd file: '%s'", filename)
+	}
+
+	users := make(map[string]string, len(records))
+	for _, record := range records {
+		users[record[0]] = record[1]
+	}
+
+	t.RWMutex.Lock()
+	t.Users = users
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+func (t *Htpasswd) CheckUser(user string, pass string) bool {
+	t.RWMutex.RLock()
+	secret, ok := t.Users[user]
+	t.RWMutex.RUnlock()
+
+	return ok && auth.CheckSecret(pass, secret)
+}
+
+// PopError returns the last reload error (once)
+func (t *Htpasswd) PopError() error {
+	return t.Watcher.PopError()
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"github.com/topvisor/go-prifma/pkg/utils"
 	"golang.org/x/net/idna"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Condition interface {
@@ -13,6 +16,10 @@ type Condition interface {
 }
 
 func NewCondition(key string, typ string, val string) (Condition, error) {
+	if key == "time" {
+		return NewConditionTime(typ, val)
+	}
+
 	tester, err := NewConditionTester(typ, val)
 	if err != nil {
 		return nil, err
@@ -25,10 +32,22 @@ func NewCondition(key string, typ string, val string) (Condition, error) {
 		return NewConditionDstDomain(tester), nil
 	case key == "dst_url":
 		return NewConditionDstUrl(tester), nil
+	case key == "sni":
+		return NewConditionSni(tester), nil
 	case strings.HasPrefix(key, "header_"):
 		return NewConditionHeader(tester, key), nil
 	case key == "user":
 		return NewConditionUser(tester), nil
+	case key == "group":
+		return NewConditionGroup(tester, DefaultUserGroups), nil
+	case strings.HasPrefix(key, "jwt_claim_"):
+		return NewConditionJwtClaim(tester, key), nil
+	case key == "src_country":
+		return NewConditionSrcCountry(tester, DefaultGeoIp), nil
+	case key == "dst_country":
+		return NewConditionDstCountry(tester, DefaultGeoIp), nil
+	case key == "dst_asn":
+		return NewConditionDstAsn(tester, DefaultGeoIp), nil
 	}
 
 	return nil, fmt.Errorf("unavailable condition key - '%s'", key)
@@ -45,7 +64,7 @@ func NewConditionSrcIp(tester ConditionTester) *ConditionSrcIp {
 }
 
 func (t *ConditionSrcIp) Test(req *http.Request) bool {
-	return t.Tester.Test(req.RemoteAddr)
+	return t.Tester.Test(utils.GetHostname(req.RemoteAddr))
 }
 
 type ConditionDstDomain struct {
@@ -86,6 +105,20 @@ func (t *ConditionDstUrl) Test(req *http.Request) bool {
 	return t.Tester.Test(url)
 }
 
+type ConditionSni struct {
+	Tester ConditionTester
+}
+
+func NewConditionSni(tester ConditionTester) *ConditionSni {
+	return &ConditionSni{
+		Tester: tester,
+	}
+}
+
+func (t *ConditionSni) Test(req *http.Request) bool {
+	return t.Tester.Test(GetServerName(req))
+}
+
 type ConditionHeader struct {
 	Tester ConditionTester
 	Name   string
@@ -122,3 +155,250 @@ func (t *ConditionUser) Test(req *http.Request) bool {
 
 	return t.Tester.Test(user)
 }
+
+type ConditionGroup struct {
+	Tester     ConditionTester
+	UserGroups UserGroups
+}
+
+func NewConditionGroup(tester ConditionTester, userGroups UserGroups) *ConditionGroup {
+	return &ConditionGroup{
+		Tester:     tester,
+		UserGroups: userGroups,
+	}
+}
+
+func (t *ConditionGroup) Test(req *http.Request) bool {
+	user, _, _ := utils.ProxyBasicAuth(req)
+
+	return TestAny(t.Tester, t.UserGroups.GetUserGroups(user))
+}
+
+// ConditionJwtClaim tests the claim of proxy bearer token verified by "jwt_auth" of the context the condition is defined in.
+// If the claim is an array, any of its values can match
+type ConditionJwtClaim struct {
+	Tester     ConditionTester
+	Name       string
+	JwtModules []Module
+}
+
+func NewConditionJwtClaim(tester ConditionTester, key string) *ConditionJwtClaim {
+	return &ConditionJwtClaim{
+		Tester: tester,
+		Name:   strings.Replace(key, "jwt_claim_", "", 1),
+	}
+}
+
+func (t *ConditionJwtClaim) SetJwtModules(modules []Module) {
+	t.JwtModules = modules
+}
+
+func (t *ConditionJwtClaim) Test(req *http.Request) bool {
+	vals := make([]string, 0)
+
+	if token, ok := utils.ProxyBearerToken(req); ok {
+		if verifier := GetJwtVerifier(t.JwtModules); verifier != nil {
+			if claims, ok := VerifyRequestJwt(req, verifier, token); ok {
+				vals = appendJwtClaimValues(vals, claims[t.Name])
+			}
+		}
+	}
+
+	if len(vals) == 0 {
+		vals = append(vals, "")
+	}
+
+	return TestAny(t.Tester, vals)
+}
+
+func appendJwtClaimValues(vals []string, claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		vals = append(vals, claim)
+	case float64:
+		vals = append(vals, strconv.FormatFloat(claim, 'f', -1, 64))
+	case bool:
+		vals = append(vals, strconv.FormatBool(claim))
+	case []interface{}:
+		for _, item := range claim {
+			vals = appendJwtClaimValues(vals, item)
+		}
+	}
+
+	return vals
+}
+
+// ConditionGeoIp is the condition requiring the geoip database
+type ConditionGeoIp interface {
+	GetGeoIp() GeoIp
+}
+
+// ConditionJwt is the condition verifying the token by "jwt_auth" of the context the condition is defined in
+type ConditionJwt interface {
+	SetJwtModules(modules []Module)
+}
+
+// ConditionDstIp is the condition resolving the destination by dialer modules (e.g. "resolver" and "hosts")
+// of the context the condition is defined in, so the same ips are dialed
+type ConditionDstIp interface {
+	SetDialerModules(modules []Module)
+}
+
+type ConditionSrcCountry struct {
+	Tester ConditionTester
+	GeoIp  GeoIp
+}
+
+func NewConditionSrcCountry(tester ConditionTester, geoIp GeoIp) *ConditionSrcCountry {
+	return &ConditionSrcCountry{
+		Tester: tester,
+		GeoIp:  geoIp,
+	}
+}
+
+func (t *ConditionSrcCountry) GetGeoIp() GeoIp {
+	return t.GeoIp
+}
+
+func (t *ConditionSrcCountry) Test(req *http.Request) bool {
+	ip := net.ParseIP(utils.GetHostname(req.RemoteAddr))
+	if ip == nil {
+		return false
+	}
+
+	record, err := t.GeoIp.Lookup(ip)
+	if err != nil {
+		return false
+	}
+
+	return t.Tester.Test(record.Country.IsoCode)
+}
+
+type ConditionDstCountry struct {
+	Tester        ConditionTester
+	GeoIp         GeoIp
+	DialerModules []Module
+}
+
+func NewConditionDstCountry(tester ConditionTester, geoIp GeoIp) *ConditionDstCountry {
+	return &ConditionDstCountry{
+		Tester: tester,
+		GeoIp:  geoIp,
+	}
+}
+
+func (t *ConditionDstCountry) GetGeoIp() GeoIp {
+	return t.GeoIp
+}
+
+func (t *ConditionDstCountry) SetDialerModules(modules []Module) {
+	t.DialerModules = modules
+}
+
+func (t *ConditionDstCountry) Test(req *http.Request) bool {
+	ip := lookupDstIp(req, t.DialerModules)
+	if ip == nil {
+		return false
+	}
+
+	record, err := t.GeoIp.Lookup(ip)
+	if err != nil {
+		return false
+	}
+
+	return t.Tester.Test(record.Country.IsoCode)
+}
+
+type ConditionDstAsn struct {
+	Tester        ConditionTester
+	GeoIp         GeoIp
+	DialerModules []Module
+}
+
+func NewConditionDstAsn(tester ConditionTester, geoIp GeoIp) *ConditionDstAsn {
+	return &ConditionDstAsn{
+		Tester: tester,
+		GeoIp:  geoIp,
+	}
+}
+
+func (t *ConditionDstAsn) GetGeoIp() GeoIp {
+	return t.GeoIp
+}
+
+func (t *ConditionDstAsn) SetDialerModules(modules []Module) {
+	t.DialerModules = modules
+}
+
+func (t *ConditionDstAsn) Test(req *http.Request) bool {
+	ip := lookupDstIp(req, t.DialerModules)
+	if ip == nil {
+		return false
+	}
+
+	record, err := t.GeoIp.Lookup(ip)
+	if err != nil || record.AutonomousSystemNumber == 0 {
+		return false
+	}
+
+	return t.Tester.Test(strconv.FormatUint(uint64(record.AutonomousSystemNumber), 10))
+}
+
+func lookupDstIp(req *http.Request, modules []Module) net.IP {
+	host := utils.GetHostname(req.Host)
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+
+	dialer := NewDialer()
+	for _, module := range modules {
+		if dialerModule, ok := module.(DialerModule); ok {
+			dialerModule.SetupDialer(dialer)
+		}
+	}
+
+	ips, err := dialer.LookupIp(req.Context(), host)
+	if err != nil {
+		return nil
+	}
+	if ipV4 := ips.GetIpV4(); ipV4 != nil {
+		return ipV4
+	}
+
+	return ips.GetIpV6()
+}
+
+type ConditionTime struct {
+	Schedule   Schedule
+	IsNegation bool
+}
+
+func NewConditionTime(typ string, val string) (*ConditionTime, error) {
+	t := new(ConditionTime)
+
+	if len(typ) > 1 && typ[0] == '!' {
+		t.IsNegation = true
+		typ = typ[1:]
+	}
+
+	var err error
+
+	switch typ {
+	case "in":
+		t.Schedule, err = NewScheduleWindows(val)
+	case "cron":
+		t.Schedule, err = NewScheduleCron(val)
+	default:
+		err = fmt.Errorf("unavailable time condition type - '%s'", typ)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *ConditionTime) Test(_ *http.Request) bool {
+	return t.Schedule.Contains(time.Now()) != t.IsNegation
+}
@@ -2,8 +2,13 @@ package prifma
 
 import (
 	"fmt"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"log"
 	"net"
+	"os"
 	"regexp"
+	"strings"
+	"sync"
 )
 
 type ConditionTester interface {
@@ -12,23 +17,58 @@ type ConditionTester interface {
 
 func NewConditionTester(typ string, val string) (tester ConditionTester, err error) {
 	isNegation := false
+	isIgnoreCase := false
 
-	if typ[0] == '!' {
+	if len(typ) > 1 && typ[0] == '!' {
 		isNegation = true
 		typ = typ[1:]
 	}
 
+	if len(typ) > 1 && typ[len(typ)-1] == '*' {
+		isIgnoreCase = true
+		typ = typ[:len(typ)-1]
+
+		if typ == "~" {
+			val = "(?i)" + val
+		} else {
+			val = strings.ToLower(val)
+		}
+	}
+
 	switch typ {
 	case "=":
 		tester, err = NewConditionTesterEquals(val)
+	case "^=":
+		tester, err = NewConditionTesterPrefix(val)
+	case "$=":
+		tester, err = NewConditionTesterSuffix(val)
+	case "*=":
+		tester, err = NewConditionTesterContains(val)
 	case "~":
 		tester, err = NewConditionTesterRegexp(val)
+	case "domain":
+		tester, err = NewConditionTesterDomain(val)
 	case "cidr":
 		tester, err = NewConditionTesterCIDR(val)
+	case "in_file":
+		tester, err = DefaultConditionFiles.Get(typ, val, NewConditionTesterDomainFile)
+	case "cidr_file":
+		tester, err = DefaultConditionFiles.Get(typ, val, NewConditionTesterCIDRFile)
 	default:
 		err = fmt.Errorf("unavailable condition type - '%s'", typ)
 	}
 
+	if err == nil && isIgnoreCase {
+		switch typ {
+		case "=", "^=", "$=", "*=":
+			tester = NewConditionTesterIgnoreCase(tester)
+		case "~":
+			// case-insensitive flag is already added to the regexp
+		default:
+			err = fmt.Errorf("unavailable case-insensitive condition type - '%s'", typ)
+		}
+	}
+
 	if err == nil && isNegation {
 		tester = NewConditionTesterNegation(tester)
 	}
@@ -36,6 +76,23 @@ func NewConditionTester(typ string, val string) (tester ConditionTester, err err
 	return tester, err
 }
 
+// TestAny tests if any of values matches, negation is applied to the whole result
+func TestAny(tester ConditionTester, vals []string) bool {
+	isNegation := false
+	if negation, ok := tester.(*ConditionTesterNegation); ok {
+		tester = negation.Tester
+		isNegation = true
+	}
+
+	for _, val := range vals {
+		if tester.Test(val) {
+			return !isNegation
+		}
+	}
+
+	return isNegation
+}
+
 type ConditionTesterNegation struct {
 	Tester ConditionTester
 }
@@ -48,6 +105,18 @@ func NewConditionTesterNegation(tester ConditionTester) *ConditionTesterNegation
 	return &ConditionTesterNegation{tester}
 }
 
+type ConditionTesterIgnoreCase struct {
+	Tester ConditionTester
+}
+
+func (t *ConditionTesterIgnoreCase) Test(val string) bool {
+	return t.Tester.Test(strings.ToLower(val))
+}
+
+func NewConditionTesterIgnoreCase(tester ConditionTester) *ConditionTesterIgnoreCase {
+	return &ConditionTesterIgnoreCase{tester}
+}
+
 type ConditionTesterEquals struct {
 	Value string
 }
@@ -60,6 +129,62 @@ func (t *ConditionTesterEquals) Test(val string) bool {
 	return t.Value == val
 }
 
+type ConditionTesterPrefix struct {
+	Prefix string
+}
+
+func NewConditionTesterPrefix(val string) (*ConditionTesterPrefix, error) {
+	return &ConditionTesterPrefix{val}, nil
+}
+
+func (t *ConditionTesterPrefix) Test(val string) bool {
+	return strings.HasPrefix(val, t.Prefix)
+}
+
+type ConditionTesterSuffix struct {
+	Suffix string
+}
+
+func NewConditionTesterSuffix(val string) (*ConditionTesterSuffix, error) {
+	return &ConditionTesterSuffix{val}, nil
+}
+
+func (t *ConditionTesterSuffix) Test(val string) bool {
+	return strings.HasSuffix(val, t.Suffix)
+}
+
+type ConditionTesterContains struct {
+	Substring string
+}
+
+func NewConditionTesterContains(val string) (*ConditionTesterContains, error) {
+	return &ConditionTesterContains{val}, nil
+}
+
+func (t *ConditionTesterContains) Test(val string) bool {
+	return strings.Contains(val, t.Substring)
+}
+
+type ConditionTesterDomain struct {
+	Domain string
+}
+
+func NewConditionTesterDomain(val string) (*ConditionTesterDomain, error) {
+	domain := utils.NormalizeDomain(val)
+	if domain == "" {
+		return nil, fmt.Errorf("wrong domain - '%s'", val)
+	}
+
+	return &ConditionTesterDomain{domain}, nil
+}
+
+// Test matches the domain and all its subdomains
+func (t *ConditionTesterDomain) Test(val string) bool {
+	val = utils.NormalizeDomain(val)
+
+	return val == t.Domain || strings.HasSuffix(val, "."+t.Domain)
+}
+
 type ConditionTesterRegexp struct {
 	Regexp *regexp.Regexp
 }
@@ -98,3 +223,171 @@ func (t *ConditionTesterCIDR) Test(val string) bool {
 
 	return t.Net.Contains(ip)
 }
+
+// DefaultConditionFiles are testers of files shared by all conditions with the same file
+var DefaultConditionFiles = NewConditionFiles()
+
+// ConditionTesterFile is the tester of the file reloaded on change
+type ConditionTesterFile interface {
+	ConditionTester
+	GetWatcher() *utils.FileWatcher
+}
+
+// ConditionFiles keeps testers of files, reload errors are written to ErrorLog
+type ConditionFiles struct {
+	Testers  map[string]ConditionTesterFile
+	ErrorLog *log.Logger
+	Mutex    *sync.Mutex
+}
+
+func NewConditionFiles() *ConditionFiles {
+	return &ConditionFiles{
+		Testers:  make(map[string]ConditionTesterFile),
+		ErrorLog: log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lmicroseconds),
+		Mutex:    new(sync.Mutex),
+	}
+}
+
+// Get returns the tester of the file, the file is watched once for all conditions
+func (t *ConditionFiles) Get(typ string, filename string, create func(filename string) (ConditionTesterFile, error)) (ConditionTesterFile, error) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	key := typ + "\x00" + filename
+	if tester, ok := t.Testers[key]; ok {
+		return tester, nil
+	}
+
+	tester, err := create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Testers[key] = tester
+
+	tester.GetWatcher().SetErrorHandler(func(err error) {
+		t.Mutex.Lock()
+		errorLog := t.ErrorLog
+		t.Mutex.Unlock()
+
+		errorLog.Printf("can't reload condition file: '%s' (%v)", filename, err)
+	})
+
+	return tester, nil
+}
+
+func (t *ConditionFiles) SetErrorLog(errorLog *log.Logger) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.ErrorLog = errorLog
+}
+
+type ConditionTesterDomainFile struct {
+	Tree    *utils.DomainTree
+	RWMutex *sync.RWMutex
+	Watcher *utils.FileWatcher
+}
+
+func NewConditionTesterDomainFile(filename string) (ConditionTesterFile, error) {
+	t := &ConditionTesterDomainFile{
+		RWMutex: new(sync.RWMutex),
+	}
+
+	watcher, err := utils.WatchFile(filename, t.Load)
+	if err != nil {
+		return nil, fmt.Errorf("can't load domains file: '%s' (%v)", filename, err)
+	}
+
+	t.Watcher = watcher
+
+	return t, nil
+}
+
+func (t *ConditionTesterDomainFile) Load(filename string) error {
+	lines, err := utils.ReadFileLines(filename)
+	if err != nil {
+		return err
+	}
+
+	tree := utils.NewDomainTree()
+	for _, line := range lines {
+		tree.Add(line, nil)
+	}
+
+	t.RWMutex.Lock()
+	t.Tree = tree
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+func (t *ConditionTesterDomainFile) GetWatcher() *utils.FileWatcher {
+	return t.Watcher
+}
+
+func (t *ConditionTesterDomainFile) Test(val string) bool {
+	t.RWMutex.RLock()
+	tree := t.Tree
+	t.RWMutex.RUnlock()
+
+	return tree.Contains(val)
+}
+
+type ConditionTesterCIDRFile struct {
+	Tree    *utils.IpTree
+	RWMutex *sync.RWMutex
+	Watcher *utils.FileWatcher
+}
+
+func NewConditionTesterCIDRFile(filename string) (ConditionTesterFile, error) {
+	t := &ConditionTesterCIDRFile{
+		RWMutex: new(sync.RWMutex),
+	}
+
+	watcher, err := utils.WatchFile(filename, t.Load)
+	if err != nil {
+		return nil, fmt.Errorf("can't load networks file: '%s' (%v)", filename, err)
+	}
+
+	t.Watcher = watcher
+
+	return t, nil
+}
+
+func (t *ConditionTesterCIDRFile) Load(filename string) error {
+	lines, err := utils.ReadFileLines(filename)
+	if err != nil {
+		return err
+	}
+
+	tree := utils.NewIpTree()
+	for _, line := range lines {
+		if err = tree.AddString(line); err != nil {
+			return err
+		}
+	}
+
+	t.RWMutex.Lock()
+	t.Tree = tree
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+func (t *ConditionTesterCIDRFile) GetWatcher() *utils.FileWatcher {
+	return t.Watcher
+}
+
+func (t *ConditionTesterCIDRFile) Test(val string) bool {
+	ip := net.ParseIP(val)
+	if ip == nil {
+		return false
+	}
+
+	t.RWMutex.RLock()
+	tree := t.Tree
+	t.RWMutex.RUnlock()
+
+	return tree.Contains(ip)
+}
@@ -4,20 +4,60 @@ import (
 	"github.com/topvisor/go-prifma/pkg/conf"
 )
 
+// ConfigChecks are called after the config is loaded (e.g. to check directives which may be defined later)
+type ConfigChecks struct {
+	Items []func() error
+}
+
+func NewConfigChecks() *ConfigChecks {
+	return &ConfigChecks{
+		Items: make([]func() error, 0),
+	}
+}
+
+func (t *ConfigChecks) Add(check func() error) {
+	t.Items = append(t.Items, check)
+}
+
+func (t *ConfigChecks) Check() error {
+	for _, check := range t.Items {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type ConfigMain struct {
 	ConfigServer conf.Block
 	ConfigModule conf.Block
+	Checks       *ConfigChecks
 }
 
 func NewConfigMain(server Server) *ConfigMain {
+	checks := NewConfigChecks()
+
 	return &ConfigMain{
 		ConfigServer: NewConfigServer(server),
-		ConfigModule: NewConfigModule(server.GetModulesManager()),
+		ConfigModule: NewConfigModule(server.GetModulesManager(), checks),
+		Checks:       checks,
 	}
 }
 
+func (t *ConfigMain) Check() error {
+	return t.Checks.Check()
+}
+
 func (t *ConfigMain) Call(command conf.Command) error {
-	return t.ConfigModule.Call(command)
+	switch command.GetName() {
+	case "geoip_db":
+		return t.CallGeoIpDb(command)
+	case "basic_auth_groups":
+		return t.CallBasicAuthGroups(command)
+	default:
+		return t.ConfigModule.Call(command)
+	}
 }
 
 func (t *ConfigMain) CallBlock(command conf.Command) (conf.Block, error) {
@@ -29,6 +69,36 @@ func (t *ConfigMain) CallBlock(command conf.Command) (conf.Block, error) {
 	}
 }
 
+func (t *ConfigMain) CallGeoIpDb(command conf.Command) error {
+	if len(command.GetArgs()) == 0 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	for _, filename := range command.GetArgs() {
+		if err := DefaultGeoIp.AddDb(filename); err != nil {
+			return conf.NewErrCommand(command, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (t *ConfigMain) CallBasicAuthGroups(command conf.Command) error {
+	if len(command.GetArgs()) != 1 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	if command.GetArgs()[0] == "off" {
+		return DefaultUserGroups.Off()
+	}
+
+	if err := DefaultUserGroups.LoadGroupsFile(command.GetArgs()[0]); err != nil {
+		return conf.NewErrCommand(command, err.Error())
+	}
+
+	return nil
+}
+
 type ConfigServer struct {
 	Server Server
 }
@@ -69,6 +139,8 @@ func (t *ConfigServer) Call(command conf.Command) (err error) {
 		err = t.Server.SetWriteTimeout(arg)
 	case "idle_timeout":
 		err = t.Server.SetIdleTimeout(arg)
+	case "metrics_listen":
+		err = t.Server.SetMetricsAddr(arg)
 	default:
 		return conf.NewErrCommandName(command)
 	}
@@ -95,12 +167,14 @@ func (t *ConfigServer) CallBlock(command conf.Command) (conf.Block, error) {
 type ConfigModule struct {
 	ModulesManager ModulesManager
 	Conds          []Condition
+	Checks         *ConfigChecks
 }
 
-func NewConfigModule(modulesManager ModulesManager) *ConfigModule {
+func NewConfigModule(modulesManager ModulesManager, checks *ConfigChecks) *ConfigModule {
 	return &ConfigModule{
 		ModulesManager: modulesManager,
 		Conds:          make([]Condition, 0),
+		Checks:         checks,
 	}
 }
 
@@ -137,9 +211,29 @@ func (t *ConfigModule) CallCondition(command conf.Command) (conf.Block, error) {
 		return nil, conf.NewErrCommand(command, err.Error())
 	}
 
+	if geoIpCond, ok := cond.(ConditionGeoIp); ok {
+		t.Checks.Add(func() error {
+			if !geoIpCond.GetGeoIp().HasDb() {
+				return conf.NewErrCommand(command, ErrGeoIpDbNotDefined.Error())
+			}
+
+			return nil
+		})
+	}
+
+	// the condition is tested with modules of the current context
+	if dstIpCond, ok := cond.(ConditionDstIp); ok {
+		dstIpCond.SetDialerModules(t.ModulesManager.GetModules(t.Conds...))
+	}
+
+	if jwtCond, ok := cond.(ConditionJwt); ok {
+		jwtCond.SetJwtModules(t.ModulesManager.GetModules(t.Conds...))
+	}
+
 	conditionBlock := &ConfigModule{
 		ModulesManager: t.ModulesManager,
 		Conds:          append(t.Conds, cond),
+		Checks:         t.Checks,
 	}
 
 	return conditionBlock, nil
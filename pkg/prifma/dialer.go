@@ -5,17 +5,42 @@ import (
 	"errors"
 	"github.com/topvisor/go-prifma/pkg/utils"
 	"net"
+	"strings"
+	"syscall"
+	"time"
 )
 
-var ErrOutgoingIpNotDefined = errors.New("outgoing ip address wasn't defined")
+var (
+	ErrOutgoingIpNotDefined = errors.New("outgoing ip address wasn't defined")
+	ErrIpFamilyNotAvailable = errors.New("no outgoing ip address for the address family of the destination")
+)
+
+// HappyEyeballsDelay - delay before the connection of the second address family is started (RFC 8305)
+const HappyEyeballsDelay = 250 * time.Millisecond
 
 type Dialer interface {
 	GetIpV4() net.IP
 	GetIpV6() net.IP
 	GetLocalIp(hostname string) (net.IP, error)
+	GetFamilyIps() (ipV4 net.IP, ipV6 net.IP)
+	GetFreeBind() bool
+	GetRandomIp() bool
+	GetInterface() string
+	GetMark() int
+	GetIpFamily() IpFamily
+	GetDNS() DNS
+	GetHosts() StaticHosts
+	LookupIp(ctx context.Context, host string) (DNSIps, error)
 
 	SetIpV4(ip net.IP)
 	SetIpV6(ip net.IP)
+	SetFreeBind(freeBind bool)
+	SetRandomIp(randomIp bool)
+	SetInterface(iface string)
+	SetMark(mark int)
+	SetIpFamily(family IpFamily)
+	SetDNS(dns DNS)
+	SetHosts(hosts StaticHosts)
 
 	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
@@ -25,9 +50,16 @@ func NewDialer() *DefaultDialer {
 }
 
 type DefaultDialer struct {
-	IpV4   net.IP
-	IpV6   net.IP
-	Dialer net.Dialer
+	IpV4      net.IP
+	IpV6      net.IP
+	FreeBind  bool   // allow binding to ip not assigned to the interface
+	RandomIp  bool   // the ip is selected from the range for the request, so connections aren't reused
+	Interface string // SO_BINDTODEVICE
+	Mark      int    // SO_MARK
+	IpFamily  IpFamily
+	DNS       DNS // DefaultDNS if nil
+	Hosts     StaticHosts
+	Dialer    net.Dialer
 }
 
 func (t *DefaultDialer) GetIpV4() net.IP {
@@ -38,32 +70,101 @@ func (t *DefaultDialer) GetIpV6() net.IP {
 	return t.IpV6
 }
 
+// GetLocalIp returns the outgoing ip of the preferred address family available for the hostname
 func (t *DefaultDialer) GetLocalIp(hostname string) (net.IP, error) {
-	var localIp net.IP
+	ipV4, ipV6 := t.GetFamilyIps()
 
 	switch true {
-	case t.IpV4 != nil && t.IpV6 != nil:
-		dstIpV4, _, err := utils.LookupIp(hostname)
-		if err != nil {
-			return nil, err
-		}
+	case ipV4 == nil && ipV6 == nil:
+		return nil, ErrOutgoingIpNotDefined
+	case ipV6 == nil:
+		return ipV4, nil
+	case ipV4 == nil:
+		return ipV6, nil
+	}
+
+	dstIps, err := t.LookupIp(context.Background(), hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	dstIpV4, dstIpV6 := dstIps.GetIpV4(), dstIps.GetIpV6()
+
+	if t.IpFamily == IpFamilyPreferV6 && dstIpV6 != nil || dstIpV4 == nil {
+		return ipV6, nil
+	}
+
+	return ipV4, nil
+}
+
+// GetFamilyIps returns outgoing ips allowed by the ip family
+func (t *DefaultDialer) GetFamilyIps() (ipV4 net.IP, ipV6 net.IP) {
+	switch t.IpFamily {
+	case IpFamilyOnlyV4:
+		return t.IpV4, nil
+	case IpFamilyOnlyV6:
+		return nil, t.IpV6
+	}
+
+	return t.IpV4, t.IpV6
+}
+
+func (t *DefaultDialer) GetFreeBind() bool {
+	return t.FreeBind
+}
+
+func (t *DefaultDialer) GetRandomIp() bool {
+	return t.RandomIp
+}
+
+func (t *DefaultDialer) GetInterface() string {
+	return t.Interface
+}
+
+func (t *DefaultDialer) GetMark() int {
+	return t.Mark
+}
 
-		if dstIpV4 != nil {
-			localIp = t.IpV4
-		} else {
-			localIp = t.IpV6
+func (t *DefaultDialer) GetIpFamily() IpFamily {
+	return t.IpFamily
+}
+
+func (t *DefaultDialer) GetDNS() DNS {
+	if t.DNS == nil {
+		return DefaultDNS
+	}
+
+	return t.DNS
+}
+
+func (t *DefaultDialer) GetHosts() StaticHosts {
+	return t.Hosts
+}
+
+// LookupIp returns ips of the host from static hosts or DNS.
+// DNS servers are connected from outgoing ips of the dialer, by the system dialer if they aren't defined
+// (e.g. the destination is resolved for conditions before "outgoing_ip")
+func (t *DefaultDialer) LookupIp(ctx context.Context, host string) (DNSIps, error) {
+	if t.Hosts != nil {
+		if ips, ok := t.Hosts.Lookup(host); ok {
+			return ips, nil
 		}
-	case t.IpV4 != nil:
-		localIp = t.IpV4
-	case t.IpV6 != nil:
-		localIp = t.IpV6
 	}
 
-	if localIp == nil {
-		return nil, ErrOutgoingIpNotDefined
+	if ipV4, ipV6 := t.GetFamilyIps(); ipV4 != nil || ipV6 != nil {
+		ctx = WithDNSDialer(ctx, t.CloneForDNS())
 	}
 
-	return localIp, nil
+	return t.GetDNS().LookupIp(ctx, host)
+}
+
+// CloneForDNS returns the copy of the dialer for connections to DNS servers,
+// the copy resolves hostnames of DNS servers by DefaultDNS
+func (t *DefaultDialer) CloneForDNS() Dialer {
+	dialer := *t
+	dialer.DNS = nil
+
+	return &dialer
 }
 
 func (t *DefaultDialer) SetIpV4(ip net.IP) {
@@ -74,20 +175,199 @@ func (t *DefaultDialer) SetIpV6(ip net.IP) {
 	t.IpV6 = ip.To16()
 }
 
+func (t *DefaultDialer) SetFreeBind(freeBind bool) {
+	t.FreeBind = freeBind
+}
+
+func (t *DefaultDialer) SetRandomIp(randomIp bool) {
+	t.RandomIp = randomIp
+}
+
+func (t *DefaultDialer) SetInterface(iface string) {
+	t.Interface = iface
+}
+
+func (t *DefaultDialer) SetMark(mark int) {
+	t.Mark = mark
+}
+
+func (t *DefaultDialer) SetIpFamily(family IpFamily) {
+	t.IpFamily = family
+}
+
+func (t *DefaultDialer) SetDNS(dns DNS) {
+	t.DNS = dns
+}
+
+func (t *DefaultDialer) SetHosts(hosts StaticHosts) {
+	t.Hosts = hosts
+}
+
+// DialContext connects from the outgoing ip of each address family of the destination.
+// If both families are available, they are raced as described in RFC 8305 (Happy Eyeballs).
 func (t *DefaultDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
-	host, _, err := net.SplitHostPort(address)
+	host, port, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
 	}
 
-	localIp, err := t.GetLocalIp(host)
+	// errors are wrapped like errors of net.Dialer
+	opError := func(err error) error {
+		return &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	localIpV4, localIpV6 := t.GetFamilyIps()
+	if localIpV4 == nil && localIpV6 == nil {
+		return nil, opError(ErrOutgoingIpNotDefined)
+	}
+
+	if strings.HasSuffix(network, "4") {
+		localIpV6 = nil
+	} else if strings.HasSuffix(network, "6") {
+		localIpV4 = nil
+	}
+
+	// the same cached answer is used by GetLocalIp to select the outgoing ip
+	dstIps, err := t.LookupIp(ctx, host)
 	if err != nil {
-		return nil, err
+		return nil, opError(err)
+	}
+
+	dstIpsV4, dstIpsV6 := dstIps.IpsV4, dstIps.IpsV6
+
+	if localIpV4 == nil {
+		dstIpsV4 = nil
+	}
+	if localIpV6 == nil {
+		dstIpsV6 = nil
+	}
+
+	primary := func(ctx context.Context) (net.Conn, error) {
+		return t.DialIps(ctx, network, localIpV4, dstIpsV4, port)
+	}
+	fallback := func(ctx context.Context) (net.Conn, error) {
+		return t.DialIps(ctx, network, localIpV6, dstIpsV6, port)
+	}
+	if t.IpFamily == IpFamilyPreferV6 {
+		primary, fallback = fallback, primary
 	}
 
-	t.Dialer.LocalAddr = &net.TCPAddr{
-		IP: localIp,
+	switch true {
+	case len(dstIpsV4) == 0 && len(dstIpsV6) == 0:
+		return nil, opError(ErrIpFamilyNotAvailable)
+	case len(dstIpsV4) == 0:
+		return t.DialIps(ctx, network, localIpV6, dstIpsV6, port)
+	case len(dstIpsV6) == 0:
+		return t.DialIps(ctx, network, localIpV4, dstIpsV4, port)
 	}
 
-	return t.Dialer.DialContext(ctx, network, address)
+	return DialParallel(ctx, primary, fallback)
+}
+
+// DialIps connects from the local ip to the first available destination ip
+func (t *DefaultDialer) DialIps(ctx context.Context, network string, localIp net.IP, dstIps []net.IP, port string) (conn net.Conn, err error) {
+	dialer := t.Dialer
+	if strings.HasPrefix(network, "udp") {
+		dialer.LocalAddr = &net.UDPAddr{
+			IP: localIp,
+		}
+	} else {
+		dialer.LocalAddr = &net.TCPAddr{
+			IP: localIp,
+		}
+	}
+
+	if t.FreeBind || t.Interface != "" || t.Mark != 0 {
+		dialer.Control = t.Control
+	}
+
+	for _, dstIp := range dstIps {
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(dstIp.String(), port)); err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+// Control sets socket options before the connection (free bind, interface, mark)
+func (t *DefaultDialer) Control(network string, _ string, conn syscall.RawConn) error {
+	var err error
+
+	controlErr := conn.Control(func(fd uintptr) {
+		err = setSocketOptions(network, fd, t.FreeBind, t.Interface, t.Mark)
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+
+	return err
+}
+
+type dialParallelResult struct {
+	Conn    net.Conn
+	Err     error
+	Primary bool
+}
+
+// DialParallel starts the fallback dial after HappyEyeballsDelay or the primary dial failure
+// and returns the first established connection
+func DialParallel(ctx context.Context, primary, fallback func(ctx context.Context) (net.Conn, error)) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialParallelResult)
+	returned := make(chan struct{})
+	defer close(returned)
+
+	dial := func(dial func(ctx context.Context) (net.Conn, error), primary bool) {
+		conn, err := dial(ctx)
+
+		select {
+		case results <- dialParallelResult{Conn: conn, Err: err, Primary: primary}:
+		case <-returned:
+			if conn != nil {
+				utils.CloseFile(conn)
+			}
+		}
+	}
+
+	go dial(primary, true)
+
+	timer := time.NewTimer(HappyEyeballsDelay)
+	defer timer.Stop()
+
+	fallbackStarted := false
+	var primaryErr error
+	failed := 0
+
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				go dial(fallback, false)
+			}
+		case result := <-results:
+			if result.Err == nil {
+				return result.Conn, nil
+			}
+
+			failed++
+			if result.Primary {
+				primaryErr = result.Err
+			}
+			if failed == 2 {
+				return nil, primaryErr
+			}
+
+			if !fallbackStarted {
+				fallbackStarted = true
+				go dial(fallback, false)
+			}
+		}
+	}
 }
@@ -0,0 +1,36 @@
+package prifma
+
+// DialerKey identifies options of the dialer, e.g. to share transports keeping connections alive.
+// Transports of dialers with random ips (see Dialer.GetRandomIp) must not be shared.
+type DialerKey struct {
+	LocalIpV4 string
+	LocalIpV6 string
+	FreeBind  bool
+	IpFamily  IpFamily
+	DNS       DNS
+	Hosts     StaticHosts
+	Interface string
+	Mark      int
+}
+
+func NewDialerKey(dialer Dialer) DialerKey {
+	t := DialerKey{}
+
+	// the transport is shared by requests to different hosts, so the key contains ips of both families
+	localIpV4, localIpV6 := dialer.GetFamilyIps()
+	if localIpV4 != nil {
+		t.LocalIpV4 = localIpV4.String()
+	}
+	if localIpV6 != nil {
+		t.LocalIpV6 = localIpV6.String()
+	}
+
+	t.FreeBind = dialer.GetFreeBind()
+	t.IpFamily = dialer.GetIpFamily()
+	t.DNS = dialer.GetDNS()
+	t.Hosts = dialer.GetHosts()
+	t.Interface = dialer.GetInterface()
+	t.Mark = dialer.GetMark()
+
+	return t
+}
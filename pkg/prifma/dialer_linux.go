@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package prifma
+
+import (
+	"syscall"
+)
+
+// FreeBindSupported - ips not assigned to the interface can be used (ranges of outgoing ips)
+const FreeBindSupported = true
+
+const (
+	ipFreeBind   = 0xf  // IP_FREEBIND
+	ipV6FreeBind = 0x4e // IPV6_FREEBIND
+)
+
+func setSocketOptions(network string, fd uintptr, freeBind bool, iface string, mark int) error {
+	if freeBind {
+		var err error
+		if network == "tcp6" || network == "udp6" {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, ipV6FreeBind, 1)
+		} else {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, ipFreeBind, 1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if iface != "" {
+		if err := syscall.BindToDevice(int(fd), iface); err != nil {
+			return err
+		}
+	}
+
+	if mark != 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, mark); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package prifma
+
+import (
+	"errors"
+)
+
+// FreeBindSupported - ips not assigned to the interface can be used (ranges of outgoing ips)
+const FreeBindSupported = false
+
+var ErrSocketOptionNotSupported = errors.New("outgoing interface and mark are supported only on linux")
+
+// setSocketOptions ignores free bind, ranges of outgoing ips are rejected on config loading,
+// ips of networks requested by "use_ip_header" must be assigned to the interface
+func setSocketOptions(_ string, _ uintptr, _ bool, iface string, mark int) error {
+	if iface != "" || mark != 0 {
+		return ErrSocketOptionNotSupported
+	}
+
+	return nil
+}
@@ -1,62 +1,281 @@
 package prifma
 
-import "net"
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DNSMinTtl        = 10 * time.Second
+	DNSMaxTtl        = time.Hour
+	DNSNegativeTtl   = time.Minute     // max ttl of "not found" answers
+	DNSStaleTtl      = 5 * time.Minute // expired ips are used while they are being refreshed
+	DNSLookupTimeout = 10 * time.Second
+)
+
+// DefaultDNS resolves destinations of the dialer and conditions
+var DefaultDNS = NewDNS(nil)
 
 type DNSIps struct {
-	IpV4 net.IP
-	IpV6 net.IP
+	IpsV4 []net.IP
+	IpsV6 []net.IP
+}
+
+func NewDNSIps(ips []net.IP) DNSIps {
+	t := DNSIps{}
+
+	for _, ip := range ips {
+		if ipV4 := ip.To4(); ipV4 != nil {
+			t.IpsV4 = append(t.IpsV4, ipV4)
+		} else {
+			t.IpsV6 = append(t.IpsV6, ip)
+		}
+	}
+
+	return t
+}
+
+func (t DNSIps) GetIpV4() net.IP {
+	if len(t.IpsV4) == 0 {
+		return nil
+	}
+
+	return t.IpsV4[0]
+}
+
+func (t DNSIps) GetIpV6() net.IP {
+	if len(t.IpsV6) == 0 {
+		return nil
+	}
+
+	return t.IpsV6[0]
 }
 
 type DNS interface {
-	SetCache(host string, ips DNSIps)
+	SetCache(host string, ips DNSIps, ttl time.Duration)
 	ClearCache()
 
-	LookupIp(host string) (DNSIps, error)
+	LookupIp(ctx context.Context, host string) (DNSIps, error)
 }
 
-func NewDNS() DefaultDNS {
-	return make(DefaultDNS)
+// StaticHosts are ips of hosts consulted before DNS
+type StaticHosts interface {
+	Lookup(host string) (DNSIps, bool)
 }
 
-type DefaultDNS map[string]DNSIps
+type DNSCacheItem struct {
+	Ips        DNSIps
+	Err        error
+	Expires    time.Time
+	Refreshing bool
+}
+
+type DNSLookup struct {
+	Done chan struct{}
+	Ips  DNSIps
+	Err  error
+}
+
+type DNSDialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+type dnsDialerContextKey struct{}
 
-func (t DefaultDNS) SetCache(host string, ips DNSIps) {
-	t[host] = ips
+// WithDNSDialer saves the dialer of the request to the context of the lookup
+// to connect to DNS servers from the outgoing ip of the request
+func WithDNSDialer(ctx context.Context, dialer Dialer) context.Context {
+	return context.WithValue(ctx, dnsDialerContextKey{}, dialer)
 }
 
-func (t DefaultDNS) ClearCache() {
-	for k := range t {
-		delete(t, k)
+func GetDNSDialer(ctx context.Context) Dialer {
+	dialer, _ := ctx.Value(dnsDialerContextKey{}).(Dialer)
+
+	return dialer
+}
+
+// CachedDNS caches answers for TTL of the records (clamped by DNSMinTtl and DNSMaxTtl).
+// Expired answers are returned during DNSStaleTtl while they are being refreshed in background.
+type CachedDNS struct {
+	Resolver  *net.Resolver
+	Items     map[string]*DNSCacheItem
+	Lookups   map[string]*DNSLookup
+	Mutex     *sync.Mutex
+	LastSweep time.Time
+}
+
+// NewDNS creates the cache with the resolver that connects to DNS servers by dial (the system dialer if nil)
+func NewDNS(dial DNSDialFunc) *CachedDNS {
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+
+	return &CachedDNS{
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				conn, err := dial(ctx, network, address)
+				if err != nil {
+					return nil, err
+				}
+
+				return NewDNSTtlConn(conn, GetDNSTtl(ctx)), nil
+			},
+		},
+		Items:     make(map[string]*DNSCacheItem),
+		Lookups:   make(map[string]*DNSLookup),
+		Mutex:     new(sync.Mutex),
+		LastSweep: time.Now(),
+	}
+}
+
+func (t *CachedDNS) SetCache(host string, ips DNSIps, ttl time.Duration) {
+	t.Mutex.Lock()
+	t.Items[normalizeHost(host)] = &DNSCacheItem{
+		Ips:     ips,
+		Expires: time.Now().Add(ttl),
 	}
+	t.Mutex.Unlock()
 }
 
-func (t DefaultDNS) LookupIp(host string) (DNSIps, error) {
-	ips, ok := t[host]
+func (t *CachedDNS) ClearCache() {
+	t.Mutex.Lock()
+	t.Items = make(map[string]*DNSCacheItem)
+	t.Mutex.Unlock()
+}
+
+func (t *CachedDNS) LookupIp(ctx context.Context, host string) (DNSIps, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return NewDNSIps([]net.IP{ip}), nil
+	}
+
+	host = normalizeHost(host)
+	now := time.Now()
+
+	t.Mutex.Lock()
+
+	item := t.Items[host]
+	if item != nil && now.Before(item.Expires) {
+		t.Mutex.Unlock()
+		Metrics.Add("dns_cache_hits", 1)
+
+		return item.Ips, item.Err
+	}
 
-	if !ok {
-		ipsRaw, err := net.LookupIP(host)
-		if err != nil {
-			return ips, err
+	if item != nil && item.Err == nil && now.Before(item.Expires.Add(DNSStaleTtl)) {
+		if !item.Refreshing {
+			item.Refreshing = true
+			t.startLookup(host, GetDNSDialer(ctx))
 		}
 
-		for _, ip := range ipsRaw {
-			if ipV4Tmp := ip.To4(); ipV4Tmp != nil {
-				if ips.IpV4 == nil {
-					ips.IpV4 = ipV4Tmp
-				}
-			} else {
-				if ips.IpV6 == nil {
-					ips.IpV6 = ip
-				}
-			}
+		t.Mutex.Unlock()
+		Metrics.Add("dns_cache_stale", 1)
+
+		return item.Ips, nil
+	}
+
+	lookup := t.startLookup(host, GetDNSDialer(ctx))
+
+	t.Mutex.Unlock()
+	Metrics.Add("dns_cache_misses", 1)
+
+	select {
+	case <-lookup.Done:
+		return lookup.Ips, lookup.Err
+	case <-ctx.Done():
+		return DNSIps{}, ctx.Err()
+	}
+}
+
+// startLookup starts the lookup of the host if it isn't started yet, must be called under the mutex
+func (t *CachedDNS) startLookup(host string, dialer Dialer) *DNSLookup {
+	if lookup := t.Lookups[host]; lookup != nil {
+		return lookup
+	}
 
-			if ips.IpV4 != nil && ips.IpV6 != nil {
-				break
-			}
+	lookup := &DNSLookup{
+		Done: make(chan struct{}),
+	}
+	t.Lookups[host] = lookup
+
+	go t.lookup(host, dialer, lookup)
+
+	return lookup
+}
+
+// lookup isn't bound to the request context, because the answer is shared by all requests to the host
+func (t *CachedDNS) lookup(host string, dialer Dialer, lookup *DNSLookup) {
+	ttl := new(DNSTtl)
+
+	ctx := WithDNSTtl(context.Background(), ttl)
+	if dialer != nil {
+		ctx = WithDNSDialer(ctx, dialer)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DNSLookupTimeout)
+	addrs, err := t.Resolver.LookupIPAddr(ctx, host)
+	cancel()
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+
+	lookup.Ips = NewDNSIps(ips)
+	lookup.Err = err
+
+	now := time.Now()
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	delete(t.Lookups, host)
+	close(lookup.Done)
+
+	item := t.Items[host]
+	stale := item != nil && item.Err == nil && now.Before(item.Expires.Add(DNSStaleTtl))
+
+	// the stale answer is kept if the refresh failed,
+	// errors of connections to DNS servers (e.g. timeouts) aren't cached unlike answers without ips
+	if err != nil && (stale || !IsDNSNotFound(err)) {
+		if item != nil {
+			item.Refreshing = false
 		}
 
-		t[host] = ips
+		return
+	}
+
+	t.sweep(now)
+
+	t.Items[host] = &DNSCacheItem{
+		Ips:     lookup.Ips,
+		Err:     err,
+		Expires: now.Add(ttl.Get(err)),
+	}
+}
+
+func (t *CachedDNS) sweep(now time.Time) {
+	if now.Sub(t.LastSweep) < DNSStaleTtl {
+		return
+	}
+
+	for host, item := range t.Items {
+		if now.After(item.Expires.Add(DNSStaleTtl)) {
+			delete(t.Items, host)
+		}
 	}
 
-	return ips, nil
+	t.LastSweep = now
+}
+
+// IsDNSNotFound returns true if the host has no ips (NXDOMAIN or no records), the answer is cached as negative
+func IsDNSNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+
+	return ok && dnsErr.IsNotFound
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
 }
@@ -0,0 +1,203 @@
+package prifma
+
+import (
+	"context"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"sync"
+	"time"
+)
+
+type dnsTtlContextKey struct{}
+
+// WithDNSTtl saves the collector of TTLs of DNS answers received during the lookup to the context
+func WithDNSTtl(ctx context.Context, ttl *DNSTtl) context.Context {
+	return context.WithValue(ctx, dnsTtlContextKey{}, ttl)
+}
+
+func GetDNSTtl(ctx context.Context) *DNSTtl {
+	ttl, _ := ctx.Value(dnsTtlContextKey{}).(*DNSTtl)
+
+	return ttl
+}
+
+// DNSTtl collects min TTL of answer records and min negative TTL (SOA) of DNS messages
+type DNSTtl struct {
+	Mutex       sync.Mutex
+	Answer      uint32
+	HasAnswer   bool
+	Negative    uint32
+	HasNegative bool
+}
+
+func (t *DNSTtl) Parse(msg []byte) {
+	var parser dnsmessage.Parser
+
+	if _, err := parser.Start(msg); err != nil {
+		return
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return
+	}
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	for {
+		header, err := parser.AnswerHeader()
+		if err != nil {
+			break
+		}
+
+		switch header.Type {
+		case dnsmessage.TypeA, dnsmessage.TypeAAAA, dnsmessage.TypeCNAME:
+			if !t.HasAnswer || header.TTL < t.Answer {
+				t.Answer = header.TTL
+				t.HasAnswer = true
+			}
+		}
+
+		if err = parser.SkipAnswer(); err != nil {
+			return
+		}
+	}
+
+	for {
+		header, err := parser.AuthorityHeader()
+		if err != nil {
+			return
+		}
+
+		if header.Type != dnsmessage.TypeSOA {
+			if err = parser.SkipAuthority(); err != nil {
+				return
+			}
+
+			continue
+		}
+
+		soa, err := parser.SOAResource()
+		if err != nil {
+			return
+		}
+
+		// RFC 2308: TTL of the negative answer is min of SOA TTL and SOA MINIMUM
+		negative := header.TTL
+		if soa.MinTTL < negative {
+			negative = soa.MinTTL
+		}
+
+		if !t.HasNegative || negative < t.Negative {
+			t.Negative = negative
+			t.HasNegative = true
+		}
+	}
+}
+
+// Get returns the cache time of the lookup result
+func (t *DNSTtl) Get(err error) time.Duration {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	if err != nil {
+		if IsDNSNotFound(err) && t.HasNegative {
+			return clampTtl(time.Duration(t.Negative)*time.Second, DNSMinTtl, DNSNegativeTtl)
+		}
+
+		return DNSMinTtl
+	}
+
+	if !t.HasAnswer {
+		// e.g. the host is found in /etc/hosts
+		return DNSMinTtl
+	}
+
+	return clampTtl(time.Duration(t.Answer)*time.Second, DNSMinTtl, DNSMaxTtl)
+}
+
+func clampTtl(ttl time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if ttl < min {
+		return min
+	}
+	if ttl > max {
+		return max
+	}
+
+	return ttl
+}
+
+// DNSTtlConn passes DNS messages read by the resolver to DNSTtl.
+// Messages of stream connections (TCP, TLS) are prefixed by 2 bytes length.
+type DNSTtlConn struct {
+	net.Conn
+	Ttl    *DNSTtl
+	Buffer []byte
+}
+
+// DNSTtlPacketConn is DNSTtlConn for packet connections (UDP), the resolver uses framing depending on net.PacketConn
+type DNSTtlPacketConn struct {
+	DNSTtlConn
+}
+
+func NewDNSTtlConn(conn net.Conn, ttl *DNSTtl) net.Conn {
+	if ttl == nil {
+		return conn
+	}
+
+	if _, ok := conn.(net.PacketConn); ok {
+		return &DNSTtlPacketConn{
+			DNSTtlConn: DNSTtlConn{
+				Conn: conn,
+				Ttl:  ttl,
+			},
+		}
+	}
+
+	return &DNSTtlConn{
+		Conn: conn,
+		Ttl:  ttl,
+	}
+}
+
+func (t *DNSTtlConn) Read(b []byte) (int, error) {
+	n, err := t.Conn.Read(b)
+	if n == 0 {
+		return n, err
+	}
+
+	t.Buffer = append(t.Buffer, b[:n]...)
+
+	for len(t.Buffer) >= 2 {
+		length := int(t.Buffer[0])<<8 | int(t.Buffer[1])
+		if len(t.Buffer) < length+2 {
+			break
+		}
+
+		t.Ttl.Parse(t.Buffer[2 : length+2])
+		t.Buffer = t.Buffer[length+2:]
+	}
+
+	return n, err
+}
+
+func (t *DNSTtlPacketConn) Read(b []byte) (int, error) {
+	n, err := t.Conn.Read(b)
+	if n != 0 {
+		t.Ttl.Parse(b[:n])
+	}
+
+	return n, err
+}
+
+func (t *DNSTtlPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := t.Conn.(net.PacketConn).ReadFrom(b)
+	if n != 0 {
+		t.Ttl.Parse(b[:n])
+	}
+
+	return n, addr, err
+}
+
+func (t *DNSTtlPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return t.Conn.(net.PacketConn).WriteTo(b, addr)
+}
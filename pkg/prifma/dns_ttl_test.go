@@ -0,0 +1,391 @@
+package prifma
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type testDNSRecord struct {
+	Type   dnsmessage.Type
+	Ttl    uint32
+	MinTtl uint32 // SOA MINIMUM
+}
+
+func buildTestDNSMessage(t *testing.T, answers []testDNSRecord, authorities []testDNSRecord) []byte {
+	t.Helper()
+
+	name := dnsmessage.MustNewName("example.com.")
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true})
+
+	addRecord := func(record testDNSRecord) error {
+		header := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: record.Ttl}
+
+		switch record.Type {
+		case dnsmessage.TypeA:
+			return builder.AResource(header, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+		case dnsmessage.TypeAAAA:
+			return builder.AAAAResource(header, dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}})
+		case dnsmessage.TypeCNAME:
+			return builder.CNAMEResource(header, dnsmessage.CNAMEResource{CNAME: name})
+		case dnsmessage.TypeTXT:
+			return builder.TXTResource(header, dnsmessage.TXTResource{TXT: []string{"txt"}})
+		case dnsmessage.TypeNS:
+			return builder.NSResource(header, dnsmessage.NSResource{NS: name})
+		case dnsmessage.TypeSOA:
+			return builder.SOAResource(header, dnsmessage.SOAResource{NS: name, MBox: name, MinTTL: record.MinTtl})
+		}
+
+		t.Fatalf("unsupported record type %v", record.Type)
+
+		return nil
+	}
+
+	if err := builder.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range answers {
+		if err := addRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := builder.StartAuthorities(); err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range authorities {
+		if err := addRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := builder.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return msg
+}
+
+func withTestLengthPrefix(msg []byte) []byte {
+	return append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+func TestDNSTtlParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		msgs        func(t *testing.T) [][]byte
+		answer      uint32
+		hasAnswer   bool
+		negative    uint32
+		hasNegative bool
+	}{
+		{
+			name: "min ttl of answers",
+			msgs: func(t *testing.T) [][]byte {
+				return [][]byte{buildTestDNSMessage(t, []testDNSRecord{
+					{Type: dnsmessage.TypeCNAME, Ttl: 600},
+					{Type: dnsmessage.TypeA, Ttl: 300},
+					{Type: dnsmessage.TypeAAAA, Ttl: 120},
+				}, nil)}
+			},
+			answer:    120,
+			hasAnswer: true,
+		},
+		{
+			name: "other answer types are ignored",
+			msgs: func(t *testing.T) [][]byte {
+				return [][]byte{buildTestDNSMessage(t, []testDNSRecord{
+					{Type: dnsmessage.TypeTXT, Ttl: 5},
+					{Type: dnsmessage.TypeA, Ttl: 100},
+				}, nil)}
+			},
+			answer:    100,
+			hasAnswer: true,
+		},
+		{
+			name: "min ttl of several messages",
+			msgs: func(t *testing.T) [][]byte {
+				return [][]byte{
+					buildTestDNSMessage(t, []testDNSRecord{{Type: dnsmessage.TypeA, Ttl: 300}}, nil),
+					buildTestDNSMessage(t, []testDNSRecord{{Type: dnsmessage.TypeAAAA, Ttl: 200}}, nil),
+					buildTestDNSMessage(t, []testDNSRecord{{Type: dnsmessage.TypeA, Ttl: 400}}, nil),
+				}
+			},
+			answer:    200,
+			hasAnswer: true,
+		},
+		{
+			name: "negative ttl is soa minimum",
+			msgs: func(t *testing.T) [][]byte {
+				return [][]byte{buildTestDNSMessage(t, nil, []testDNSRecord{
+					{Type: dnsmessage.TypeSOA, Ttl: 900, MinTtl: 60},
+				})}
+			},
+			negative:    60,
+			hasNegative: true,
+		},
+		{
+			name: "negative ttl is soa ttl",
+			msgs: func(t *testing.T) [][]byte {
+				return [][]byte{buildTestDNSMessage(t, nil, []testDNSRecord{
+					{Type: dnsmessage.TypeNS, Ttl: 5},
+					{Type: dnsmessage.TypeSOA, Ttl: 30, MinTtl: 300},
+				})}
+			},
+			negative:    30,
+			hasNegative: true,
+		},
+		{
+			name: "answers and soa",
+			msgs: func(t *testing.T) [][]byte {
+				return [][]byte{buildTestDNSMessage(t,
+					[]testDNSRecord{{Type: dnsmessage.TypeA, Ttl: 50}},
+					[]testDNSRecord{{Type: dnsmessage.TypeSOA, Ttl: 70, MinTtl: 80}},
+				)}
+			},
+			answer:      50,
+			hasAnswer:   true,
+			negative:    70,
+			hasNegative: true,
+		},
+		{
+			name: "wrong message",
+			msgs: func(t *testing.T) [][]byte {
+				return [][]byte{{1, 2, 3}, nil}
+			},
+		},
+		{
+			name: "truncated message",
+			msgs: func(t *testing.T) [][]byte {
+				msg := buildTestDNSMessage(t, []testDNSRecord{{Type: dnsmessage.TypeA, Ttl: 50}}, nil)
+
+				return [][]byte{msg[:len(msg)-8]}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ttl := new(DNSTtl)
+			for _, msg := range test.msgs(t) {
+				ttl.Parse(msg)
+			}
+
+			if ttl.HasAnswer != test.hasAnswer || ttl.Answer != test.answer {
+				t.Errorf("answer = %d (%v), want %d (%v)", ttl.Answer, ttl.HasAnswer, test.answer, test.hasAnswer)
+			}
+			if ttl.HasNegative != test.hasNegative || ttl.Negative != test.negative {
+				t.Errorf("negative = %d (%v), want %d (%v)", ttl.Negative, ttl.HasNegative, test.negative, test.hasNegative)
+			}
+		})
+	}
+}
+
+func TestDNSTtlGet(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}
+	timeout := &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}
+
+	tests := []struct {
+		name string
+		ttl  *DNSTtl
+		err  error
+		want time.Duration
+	}{
+		{
+			name: "answer",
+			ttl:  &DNSTtl{Answer: 120, HasAnswer: true},
+			want: 120 * time.Second,
+		},
+		{
+			name: "answer below min",
+			ttl:  &DNSTtl{Answer: 1, HasAnswer: true},
+			want: DNSMinTtl,
+		},
+		{
+			name: "answer above max",
+			ttl:  &DNSTtl{Answer: 100000, HasAnswer: true},
+			want: DNSMaxTtl,
+		},
+		{
+			name: "no answers",
+			ttl:  &DNSTtl{},
+			want: DNSMinTtl,
+		},
+		{
+			name: "not found",
+			ttl:  &DNSTtl{Negative: 30, HasNegative: true},
+			err:  notFound,
+			want: 30 * time.Second,
+		},
+		{
+			name: "not found above max",
+			ttl:  &DNSTtl{Negative: 3600, HasNegative: true},
+			err:  notFound,
+			want: DNSNegativeTtl,
+		},
+		{
+			name: "not found without soa",
+			ttl:  &DNSTtl{},
+			err:  notFound,
+			want: DNSMinTtl,
+		},
+		{
+			name: "other error",
+			ttl:  &DNSTtl{Answer: 120, HasAnswer: true, Negative: 30, HasNegative: true},
+			err:  timeout,
+			want: DNSMinTtl,
+		},
+		{
+			name: "not dns error",
+			ttl:  &DNSTtl{Negative: 30, HasNegative: true},
+			err:  io.EOF,
+			want: DNSMinTtl,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.ttl.Get(test.err); got != test.want {
+				t.Errorf("Get() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// testChunksConn returns chunks by reads
+type testChunksConn struct {
+	net.Conn
+	Chunks [][]byte
+}
+
+func (t *testChunksConn) Read(b []byte) (int, error) {
+	if len(t.Chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(b, t.Chunks[0])
+	if n < len(t.Chunks[0]) {
+		t.Chunks[0] = t.Chunks[0][n:]
+	} else {
+		t.Chunks = t.Chunks[1:]
+	}
+
+	return n, nil
+}
+
+func TestDNSTtlConnRead(t *testing.T) {
+	split := func(data []byte, sizes ...int) [][]byte {
+		chunks := make([][]byte, 0, len(sizes)+1)
+		for _, size := range sizes {
+			chunks = append(chunks, data[:size])
+			data = data[size:]
+		}
+
+		return append(chunks, data)
+	}
+
+	msg1 := withTestLengthPrefix(buildTestDNSMessage(t, []testDNSRecord{{Type: dnsmessage.TypeA, Ttl: 300}}, nil))
+	msg2 := withTestLengthPrefix(buildTestDNSMessage(t, []testDNSRecord{{Type: dnsmessage.TypeAAAA, Ttl: 60}}, nil))
+
+	tests := []struct {
+		name      string
+		chunks    [][]byte
+		answer    uint32
+		hasAnswer bool
+		buffered  int
+	}{
+		{
+			name:      "message in one read",
+			chunks:    [][]byte{msg1},
+			answer:    300,
+			hasAnswer: true,
+		},
+		{
+			name:      "length prefix split",
+			chunks:    split(msg1, 1),
+			answer:    300,
+			hasAnswer: true,
+		},
+		{
+			name:      "message split",
+			chunks:    split(msg1, 2, 10),
+			answer:    300,
+			hasAnswer: true,
+		},
+		{
+			name:      "messages in one read",
+			chunks:    [][]byte{append(append([]byte{}, msg1...), msg2...)},
+			answer:    60,
+			hasAnswer: true,
+		},
+		{
+			name:      "second message split",
+			chunks:    split(append(append([]byte{}, msg1...), msg2...), len(msg1)+1, 5),
+			answer:    60,
+			hasAnswer: true,
+		},
+		{
+			name:     "incomplete message",
+			chunks:   [][]byte{msg1[:len(msg1)-1]},
+			buffered: len(msg1) - 1,
+		},
+		{
+			name:      "incomplete second message",
+			chunks:    [][]byte{msg1, msg2[:1]},
+			answer:    300,
+			hasAnswer: true,
+			buffered:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ttl := new(DNSTtl)
+			conn := NewDNSTtlConn(&testChunksConn{Chunks: append([][]byte{}, test.chunks...)}, ttl)
+
+			ttlConn, ok := conn.(*DNSTtlConn)
+			if !ok {
+				t.Fatalf("NewDNSTtlConn() = %T, want *DNSTtlConn", conn)
+			}
+
+			read := make([]byte, 0)
+			b := make([]byte, 7)
+			for {
+				n, err := conn.Read(b)
+				read = append(read, b[:n]...)
+				if err != nil {
+					break
+				}
+			}
+
+			if string(read) != string(joinTestChunks(test.chunks)) {
+				t.Errorf("read data differs from the data of the connection")
+			}
+			if ttl.HasAnswer != test.hasAnswer || ttl.Answer != test.answer {
+				t.Errorf("answer = %d (%v), want %d (%v)", ttl.Answer, ttl.HasAnswer, test.answer, test.hasAnswer)
+			}
+			if len(ttlConn.Buffer) != test.buffered {
+				t.Errorf("buffered %d bytes, want %d", len(ttlConn.Buffer), test.buffered)
+			}
+		})
+	}
+}
+
+func joinTestChunks(chunks [][]byte) []byte {
+	data := make([]byte, 0)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+
+	return data
+}
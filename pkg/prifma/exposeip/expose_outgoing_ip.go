@@ -0,0 +1,64 @@
+package exposeip
+
+import (
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+)
+
+const ModuleDirective = "expose_outgoing_ip"
+
+// ExposeOutgoingIp sends the outgoing ip and the upstream proxy of the request back to the client
+type ExposeOutgoingIp struct {
+	Enabled bool
+}
+
+func New() *ExposeOutgoingIp {
+	return new(ExposeOutgoingIp)
+}
+
+func (t *ExposeOutgoingIp) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	result.SetExposeOutgoingIp(t.Enabled)
+
+	return result, nil
+}
+
+func (t *ExposeOutgoingIp) SetEnabled(enabled bool) error {
+	t.Enabled = enabled
+
+	return nil
+}
+
+func (t *ExposeOutgoingIp) GetDirective() string {
+	return ModuleDirective
+}
+
+func (t *ExposeOutgoingIp) Clone() prifma.Module {
+	clone := *t
+
+	return &clone
+}
+
+func (t *ExposeOutgoingIp) Call(command conf.Command) error {
+	if command.GetName() != ModuleDirective {
+		return conf.NewErrCommandName(command)
+	}
+
+	if len(command.GetArgs()) != 1 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	arg := command.GetArgs()[0]
+
+	switch arg {
+	case "off":
+		return t.SetEnabled(false)
+	case "on":
+		return t.SetEnabled(true)
+	}
+
+	return conf.NewErrCommandArg(command, arg)
+}
+
+func (t *ExposeOutgoingIp) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
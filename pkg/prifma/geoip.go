@@ -0,0 +1,66 @@
+package prifma
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	"net"
+)
+
+var ErrGeoIpDbNotDefined = errors.New("geoip database wasn't defined")
+
+var DefaultGeoIp = NewGeoIp()
+
+type GeoIpRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	AutonomousSystemNumber uint `maxminddb:"autonomous_system_number"`
+}
+
+type GeoIp interface {
+	AddDb(filename string) error
+	HasDb() bool
+	Lookup(ip net.IP) (*GeoIpRecord, error)
+}
+
+func NewGeoIp() *MmdbGeoIp {
+	return &MmdbGeoIp{
+		Readers: make([]*maxminddb.Reader, 0),
+	}
+}
+
+// MmdbGeoIp looks up ip in all added databases (e.g. country and ASN databases)
+type MmdbGeoIp struct {
+	Readers []*maxminddb.Reader
+}
+
+func (t *MmdbGeoIp) AddDb(filename string) error {
+	reader, err := maxminddb.Open(filename)
+	if err != nil {
+		return fmt.Errorf("can't open geoip database: '%s'", filename)
+	}
+
+	t.Readers = append(t.Readers, reader)
+
+	return nil
+}
+
+func (t *MmdbGeoIp) HasDb() bool {
+	return len(t.Readers) != 0
+}
+
+func (t *MmdbGeoIp) Lookup(ip net.IP) (*GeoIpRecord, error) {
+	if len(t.Readers) == 0 {
+		return nil, ErrGeoIpDbNotDefined
+	}
+
+	record := new(GeoIpRecord)
+	for _, reader := range t.Readers {
+		if err := reader.Lookup(ip, record); err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
@@ -15,12 +15,19 @@ type HandleRequestResult interface {
 	SetProxy(proxy ProxyFunc)
 	SetProxyConnectHeader(header http.Header)
 	SetResponse(resp Response)
+	SetAccess(access Access)
+	SetOutgoingIps(ips IpSet)
+	SetExposeOutgoingIp(expose bool)
 
 	GetRequest() *http.Request
 	GetDialer() Dialer
 	GetProxy() ProxyFunc
 	GetProxyConnectHeader() http.Header
 	GetResponse() Response
+	GetAccess() Access
+	GetOutgoingIps() IpSet
+	GetExposeOutgoingIp() bool
+	GetResponseHeader() http.Header
 	GetServer() Server
 
 	GetRoundTripper() http.RoundTripper
@@ -28,9 +35,10 @@ type HandleRequestResult interface {
 
 func NewHandleRequestResult(req *http.Request, server Server) *DefaultHandleRequestResult {
 	t := &DefaultHandleRequestResult{
-		Server:  server,
-		Request: req,
-		Dialer:  NewDialer(),
+		Server:         server,
+		Request:        req,
+		Dialer:         NewDialer(),
+		ResponseHeader: make(http.Header),
 	}
 
 	t.Transport = &http.Transport{
@@ -43,11 +51,15 @@ func NewHandleRequestResult(req *http.Request, server Server) *DefaultHandleRequ
 }
 
 type DefaultHandleRequestResult struct {
-	Server    Server
-	Request   *http.Request
-	Response  Response
-	Dialer    Dialer
-	Transport *http.Transport
+	Server           Server
+	Request          *http.Request
+	Response         Response
+	Dialer           Dialer
+	Transport        *http.Transport
+	Access           Access
+	ResponseHeader   http.Header
+	OutgoingIps      IpSet
+	ExposeOutgoingIp bool
 }
 
 func (t *DefaultHandleRequestResult) SetRequest(req *http.Request) {
@@ -70,6 +82,18 @@ func (t *DefaultHandleRequestResult) SetResponse(resp Response) {
 	t.Response = resp
 }
 
+func (t *DefaultHandleRequestResult) SetAccess(access Access) {
+	t.Access = access
+}
+
+func (t *DefaultHandleRequestResult) SetOutgoingIps(ips IpSet) {
+	t.OutgoingIps = ips
+}
+
+func (t *DefaultHandleRequestResult) SetExposeOutgoingIp(expose bool) {
+	t.ExposeOutgoingIp = expose
+}
+
 func (t *DefaultHandleRequestResult) GetRequest() *http.Request {
 	return t.Request
 }
@@ -90,6 +114,25 @@ func (t *DefaultHandleRequestResult) GetResponse() Response {
 	return t.Response
 }
 
+func (t *DefaultHandleRequestResult) GetAccess() Access {
+	return t.Access
+}
+
+// GetOutgoingIps returns ips allowed for the request (set by "outgoing_ip"), nil if not defined
+func (t *DefaultHandleRequestResult) GetOutgoingIps() IpSet {
+	return t.OutgoingIps
+}
+
+// GetExposeOutgoingIp returns true if the outgoing ip must be sent to the client (set by "expose_outgoing_ip")
+func (t *DefaultHandleRequestResult) GetExposeOutgoingIp() bool {
+	return t.ExposeOutgoingIp
+}
+
+// GetResponseHeader returns headers added to the response by modules
+func (t *DefaultHandleRequestResult) GetResponseHeader() http.Header {
+	return t.ResponseHeader
+}
+
 func (t *DefaultHandleRequestResult) GetServer() Server {
 	return t.Server
 }
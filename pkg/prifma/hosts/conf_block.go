@@ -0,0 +1,31 @@
+package hosts
+
+import (
+	"github.com/topvisor/go-prifma/pkg/conf"
+)
+
+type ConfBlock struct {
+	Table *Table
+}
+
+func NewConfBlock(table *Table) *ConfBlock {
+	return &ConfBlock{
+		Table: table,
+	}
+}
+
+func (t *ConfBlock) Call(command conf.Command) (err error) {
+	if len(command.GetArgs()) == 0 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	if err = t.Table.Add(command.GetName(), command.GetArgs()); err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *ConfBlock) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
@@ -0,0 +1,145 @@
+package hosts
+
+import (
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+)
+
+const (
+	ModuleDirective     = "hosts"
+	ModuleDirectiveFile = "hosts_file"
+)
+
+// Hosts sets static ips of destinations consulted by the dialer before DNS
+type Hosts struct {
+	Tables    []*Table
+	Inherited bool
+}
+
+func New() *Hosts {
+	return &Hosts{
+		Tables: make([]*Table, 0),
+	}
+}
+
+func (t *Hosts) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	t.SetupDialer(result.GetDialer())
+
+	for _, table := range t.Tables {
+		if err := table.PopError(); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (t *Hosts) SetupDialer(dialer prifma.Dialer) {
+	if len(t.Tables) == 0 {
+		dialer.SetHosts(nil)
+	} else {
+		dialer.SetHosts(t)
+	}
+}
+
+// Lookup returns ips of the first table containing the host
+func (t *Hosts) Lookup(host string) (prifma.DNSIps, bool) {
+	for _, table := range t.Tables {
+		if ips, ok := table.Lookup(host); ok {
+			return ips, true
+		}
+	}
+
+	return prifma.DNSIps{}, false
+}
+
+func (t *Hosts) Off() error {
+	t.Tables = make([]*Table, 0)
+	t.Inherited = false
+
+	return nil
+}
+
+// AddTable adds the table, the first table of the condition replaces tables of the parent context
+func (t *Hosts) AddTable(table *Table) {
+	if t.Inherited {
+		t.Tables = make([]*Table, 0)
+		t.Inherited = false
+	}
+
+	t.Tables = append(t.Tables[:len(t.Tables):len(t.Tables)], table)
+}
+
+func (t *Hosts) LoadFile(filename string) error {
+	table := NewTable()
+	if err := table.LoadFile(filename); err != nil {
+		return err
+	}
+
+	t.AddTable(table)
+
+	return nil
+}
+
+func (t *Hosts) GetDirective() string {
+	return ModuleDirective
+}
+
+func (t *Hosts) GetDirectives() []string {
+	return []string{ModuleDirective, ModuleDirectiveFile}
+}
+
+func (t *Hosts) Clone() prifma.Module {
+	clone := *t
+	clone.Inherited = true
+
+	return &clone
+}
+
+func (t *Hosts) Call(command conf.Command) (err error) {
+	args := command.GetArgs()
+	if len(args) != 1 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	switch command.GetName() {
+	case ModuleDirective:
+		if args[0] != "off" {
+			return conf.NewErrCommandArg(command, args[0])
+		}
+
+		return t.Off()
+	case ModuleDirectiveFile:
+		if args[0] == "off" {
+			return t.Off()
+		}
+
+		err = t.LoadFile(args[0])
+	default:
+		return conf.NewErrCommandName(command)
+	}
+
+	if err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *Hosts) CallBlock(command conf.Command) (conf.Block, error) {
+	switch command.GetName() {
+	case ModuleDirective:
+		if len(command.GetArgs()) != 0 {
+			return nil, conf.NewErrCommandArgsNumber(command)
+		}
+
+		table := NewTable()
+		t.AddTable(table)
+
+		return NewConfBlock(table), nil
+	case ModuleDirectiveFile:
+		return nil, conf.NewErrCommandMustHaveNoBlock(command)
+	}
+
+	return nil, conf.NewErrCommandName(command)
+}
@@ -0,0 +1,117 @@
+package hosts
+
+import (
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Table contains ips of domains, supported domains are described in utils.DomainTree
+type Table struct {
+	Tree    *utils.DomainTree
+	RWMutex *sync.RWMutex
+	Watcher *utils.FileWatcher
+}
+
+func NewTable() *Table {
+	return &Table{
+		Tree:    utils.NewDomainTree(),
+		RWMutex: new(sync.RWMutex),
+	}
+}
+
+func (t *Table) Lookup(host string) (prifma.DNSIps, bool) {
+	t.RWMutex.RLock()
+	value, ok := t.Tree.Get(host)
+	t.RWMutex.RUnlock()
+
+	if !ok {
+		return prifma.DNSIps{}, false
+	}
+
+	return value.(prifma.DNSIps), true
+}
+
+// Add sets ips of the domain
+func (t *Table) Add(domain string, ipStrs []string) error {
+	if len(ipStrs) == 0 {
+		return fmt.Errorf("ips of '%s' are not defined", domain)
+	}
+
+	ips := make([]net.IP, 0, len(ipStrs))
+	for _, ipStr := range ipStrs {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			return fmt.Errorf("wrong ip - '%s'", ipStr)
+		}
+
+		ips = append(ips, ip)
+	}
+
+	t.RWMutex.Lock()
+	t.Tree.Add(domain, prifma.NewDNSIps(ips))
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+// AddLine adds the line in the format "domain ip..." or "ip domain..." (/etc/hosts)
+func (t *Table) AddLine(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("wrong line - '%s'", strings.Join(fields, " "))
+	}
+
+	if net.ParseIP(fields[0]) == nil {
+		return t.Add(fields[0], fields[1:])
+	}
+
+	for _, domain := range fields[1:] {
+		if err := t.Add(domain, fields[:1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Table) LoadFile(filename string) error {
+	watcher, err := utils.WatchFile(filename, t.Load)
+	if err != nil {
+		return fmt.Errorf("can't load hosts file: '%s' (%v)", filename, err)
+	}
+
+	t.Watcher = watcher
+
+	return nil
+}
+
+func (t *Table) Load(filename string) error {
+	lines, err := utils.ReadFileLines(filename)
+	if err != nil {
+		return err
+	}
+
+	table := NewTable()
+	for _, line := range lines {
+		if err = table.AddLine(strings.Fields(line)); err != nil {
+			return fmt.Errorf("%v in hosts file: '%s'", err, filename)
+		}
+	}
+
+	t.RWMutex.Lock()
+	t.Tree = table.Tree
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+func (t *Table) PopError() error {
+	if t.Watcher == nil {
+		return nil
+	}
+
+	return t.Watcher.PopError()
+}
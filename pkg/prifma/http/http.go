@@ -24,10 +24,14 @@ func (t *Http) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRe
 		return result, nil
 	}
 
-	dialer := result.GetDialer()
+	if result.GetAccess() == prifma.AccessDenied {
+		result.SetResponse(prifma.NewResponseError(http.StatusForbidden, ""))
+
+		return result, nil
+	}
+
 	host := utils.GetHostname(result.GetRequest().Host)
-	localIp, err := dialer.GetLocalIp(host)
-	if err != nil {
+	if _, err := result.GetDialer().GetLocalIp(host); err != nil {
 		if err == prifma.ErrOutgoingIpNotDefined {
 			result.SetResponse(prifma.NewResponseError(http.StatusBadRequest, err.Error()))
 		} else {
@@ -37,14 +41,6 @@ func (t *Http) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRe
 		return result, nil
 	}
 
-	if localIpV4 := localIp.To4(); localIpV4 != nil {
-		dialer.SetIpV4(localIpV4)
-		dialer.SetIpV6(nil)
-	} else {
-		dialer.SetIpV4(nil)
-		dialer.SetIpV6(localIp)
-	}
-
 	result.SetResponse(NewResponseReverseProxy(t.RoundTrippers))
 
 	return result, nil
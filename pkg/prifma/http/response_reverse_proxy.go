@@ -12,6 +12,12 @@ import (
 	"net/http/httputil"
 )
 
+// IpHealthFailureCodes - response codes counted as failures of the outgoing ip (e.g. the ip is banned)
+var IpHealthFailureCodes = map[int]bool{
+	http.StatusForbidden:       true,
+	http.StatusTooManyRequests: true,
+}
+
 type ResponseReverseProxy struct {
 	RoundTrippers RoundTrippersMap
 	ResponseCode  int
@@ -30,11 +36,24 @@ func NewResponseReverseProxy(roundTrippers RoundTrippersMap) *ResponseReversePro
 
 func (t *ResponseReverseProxy) Write(rw http.ResponseWriter, result prifma.HandleRequestResult) error {
 	reverseProxy := &httputil.ReverseProxy{
-		Director:       utils.RemoveProxyHeaders,
-		Transport:      t.RoundTrippers.Get(result),
-		FlushInterval:  -1,
-		ModifyResponse: t.SaveResponse,
-		ErrorHandler:   t.ErrorHandler,
+		Director:      utils.RemoveProxyHeaders,
+		Transport:     t.RoundTrippers.Get(result),
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			prifma.ReportOutgoingIpHealth(result, t.LAddr, !IpHealthFailureCodes[resp.StatusCode])
+			prifma.SetOutgoingIpHeader(resp.Header, result, t.LAddr)
+
+			return t.SaveResponse(resp)
+		},
+		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
+			if err != context.Canceled {
+				prifma.ReportOutgoingIpHealth(result, t.LAddr, false)
+			}
+
+			prifma.SetOutgoingIpHeader(rw.Header(), result, t.LAddr)
+
+			t.ErrorHandler(rw, req, err)
+		},
 	}
 
 	req := result.GetRequest().WithContext(
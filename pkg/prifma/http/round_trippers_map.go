@@ -3,52 +3,101 @@ package http
 import (
 	"bytes"
 	"github.com/topvisor/go-prifma/pkg/prifma"
-	"github.com/topvisor/go-prifma/pkg/utils"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type RoundTrippersMap interface {
 	Get(result prifma.HandleRequestResult) http.RoundTripper
 }
 
+// RoundTrippersIdleTimeout - round trippers which were not used longer are removed from the map
+// (e.g. for outgoing ips of ranges bound to sessions)
+const RoundTrippersIdleTimeout = 5 * time.Minute
+
+type RoundTrippersMapItem struct {
+	LastUsed     int64 // unix nano, the first field for 64-bit alignment of atomic operations
+	RoundTripper http.RoundTripper
+}
+
 type SyncRoundTrippersMap struct {
 	RWMutex       *sync.RWMutex
-	RoundTrippers map[RoundTripperKey]http.RoundTripper
+	RoundTrippers map[RoundTripperKey]*RoundTrippersMapItem
+	LastSweep     time.Time
 }
 
 func NewSyncRoundTrippersMap() *SyncRoundTrippersMap {
 	return &SyncRoundTrippersMap{
 		RWMutex:       new(sync.RWMutex),
-		RoundTrippers: make(map[RoundTripperKey]http.RoundTripper),
+		RoundTrippers: make(map[RoundTripperKey]*RoundTrippersMapItem),
+		LastSweep:     time.Now(),
 	}
 }
 
 func (t *SyncRoundTrippersMap) Get(result prifma.HandleRequestResult) http.RoundTripper {
+	// connections from the random ip of the range wouldn't be reused
+	if result.GetDialer().GetRandomIp() {
+		roundTripper := result.GetRoundTripper()
+		if transport, ok := roundTripper.(*http.Transport); ok {
+			transport.DisableKeepAlives = true
+		}
+
+		return roundTripper
+	}
+
 	key := NewRoundTripperKey(result)
+	now := time.Now()
 
 	t.RWMutex.RLock()
-	roundTripper := t.RoundTrippers[key]
+	item := t.RoundTrippers[key]
 	t.RWMutex.RUnlock()
 
-	if roundTripper != nil {
-		return roundTripper
+	if item != nil {
+		atomic.StoreInt64(&item.LastUsed, now.UnixNano())
+
+		return item.RoundTripper
 	}
 
 	t.RWMutex.Lock()
-	if roundTripper = t.RoundTrippers[key]; roundTripper == nil {
-		roundTripper = result.GetRoundTripper()
-		t.RoundTrippers[key] = roundTripper
+	t.sweep(now)
+	if item = t.RoundTrippers[key]; item == nil {
+		item = &RoundTrippersMapItem{
+			RoundTripper: result.GetRoundTripper(),
+			LastUsed:     now.UnixNano(),
+		}
+		t.RoundTrippers[key] = item
 	}
 	t.RWMutex.Unlock()
 
-	return roundTripper
+	return item.RoundTripper
+}
+
+func (t *SyncRoundTrippersMap) sweep(now time.Time) {
+	if now.Sub(t.LastSweep) < RoundTrippersIdleTimeout {
+		return
+	}
+
+	for key, item := range t.RoundTrippers {
+		if now.Sub(time.Unix(0, atomic.LoadInt64(&item.LastUsed))) < RoundTrippersIdleTimeout {
+			continue
+		}
+
+		if transport, ok := item.RoundTripper.(interface{ CloseIdleConnections() }); ok {
+			transport.CloseIdleConnections()
+		}
+
+		delete(t.RoundTrippers, key)
+	}
+
+	t.LastSweep = now
 }
 
 type RoundTripperKey struct {
 	ProxyUrl    string
 	ProxyHeader string
-	LocalIp     string
+	Dialer      prifma.DialerKey
 }
 
 func NewRoundTripperKey(result prifma.HandleRequestResult) RoundTripperKey {
@@ -65,10 +114,7 @@ func NewRoundTripperKey(result prifma.HandleRequestResult) RoundTripperKey {
 		t.ProxyHeader = proxyHeaderBuff.String()
 	}
 
-	host := utils.GetHostname(result.GetRequest().Host)
-	if localIp, err := result.GetDialer().GetLocalIp(host); err == nil && localIp != nil {
-		t.LocalIp = localIp.String()
-	}
+	t.Dialer = prifma.NewDialerKey(result.GetDialer())
 
 	return t
 }
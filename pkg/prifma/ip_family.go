@@ -0,0 +1,31 @@
+package prifma
+
+import "fmt"
+
+// IpFamily is the address family preference for outgoing connections
+type IpFamily byte
+
+const (
+	// IpFamilyPreferV4 - IPv4 is tried first, IPv6 is tried after HappyEyeballsDelay or IPv4 failure
+	IpFamilyPreferV4 IpFamily = iota
+	// IpFamilyPreferV6 - IPv6 is tried first, IPv4 is tried after HappyEyeballsDelay or IPv6 failure
+	IpFamilyPreferV6
+	IpFamilyOnlyV4
+	IpFamilyOnlyV6
+)
+
+var ipFamilyNames = map[string]IpFamily{
+	"prefer_v4": IpFamilyPreferV4,
+	"prefer_v6": IpFamilyPreferV6,
+	"only_v4":   IpFamilyOnlyV4,
+	"only_v6":   IpFamilyOnlyV6,
+}
+
+func ParseIpFamily(name string) (IpFamily, error) {
+	family, ok := ipFamilyNames[name]
+	if !ok {
+		return IpFamilyPreferV4, fmt.Errorf("wrong ip family - '%s'", name)
+	}
+
+	return family, nil
+}
@@ -0,0 +1,136 @@
+package prifma
+
+import (
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"net"
+	"sync"
+	"time"
+)
+
+// IpHealthForgetTime - failures of ips without new failures are forgotten
+const IpHealthForgetTime = time.Hour
+
+var DefaultIpHealth = NewIpHealth()
+
+func init() {
+	Metrics.SetFunc("outgoing_ip_failures", func() interface{} {
+		return DefaultIpHealth.GetFailures()
+	})
+}
+
+type IpHealthItem struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// IpHealthSet is the set of outgoing ips with "outgoing_ip_health"
+type IpHealthSet interface {
+	IpSet
+	// GetHealthKey returns the key of ips containing the ip (the ip, the range or pairs of them and the domain),
+	// false if the health of ips isn't tracked
+	GetHealthKey(ip net.IP, domain string) (string, bool)
+}
+
+// IpHealth counts consecutive failures of outgoing ips by keys of IpHealthSet.
+// A success resets the counter.
+type IpHealth struct {
+	Items     map[string]*IpHealthItem
+	LastSweep time.Time
+	Mutex     *sync.Mutex
+}
+
+func NewIpHealth() *IpHealth {
+	return &IpHealth{
+		Items:     make(map[string]*IpHealthItem),
+		LastSweep: time.Now(),
+		Mutex:     new(sync.Mutex),
+	}
+}
+
+func (t *IpHealth) Report(key string, ok bool) {
+	now := time.Now()
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.sweep(now)
+
+	if ok {
+		delete(t.Items, key)
+
+		return
+	}
+
+	item, exists := t.Items[key]
+	if !exists {
+		item = new(IpHealthItem)
+		t.Items[key] = item
+	}
+
+	item.Failures++
+	item.LastFailure = now
+}
+
+// IsAvailable returns false during the cooldown after the threshold of failures.
+// After the cooldown the ip is available until the next failure.
+func (t *IpHealth) IsAvailable(key string, threshold int, cooldown time.Duration) bool {
+	t.Mutex.Lock()
+	item, ok := t.Items[key]
+	available := !ok || item.Failures < threshold || time.Since(item.LastFailure) >= cooldown
+	t.Mutex.Unlock()
+
+	return available
+}
+
+// GetFailures returns counters of failures by keys ("ip", "range" or with " domain")
+func (t *IpHealth) GetFailures() map[string]int {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	failures := make(map[string]int, len(t.Items))
+	for key, item := range t.Items {
+		failures[key] = item.Failures
+	}
+
+	return failures
+}
+
+func (t *IpHealth) sweep(now time.Time) {
+	if now.Sub(t.LastSweep) < IpHealthForgetTime {
+		return
+	}
+
+	for key, item := range t.Items {
+		if now.Sub(item.LastFailure) > IpHealthForgetTime {
+			delete(t.Items, key)
+		}
+	}
+
+	t.LastSweep = now
+}
+
+// ReportOutgoingIpHealth reports the result of the request to the destination for the outgoing ip.
+// Requests through the proxy ("proxy_requests") and requests without "outgoing_ip_health" are not reported.
+func ReportOutgoingIpHealth(result HandleRequestResult, lAddr net.Addr, ok bool) {
+	ips, isHealthSet := result.GetOutgoingIps().(IpHealthSet)
+	if !isHealthSet || result.GetProxy() != nil {
+		return
+	}
+
+	host := utils.GetHostname(result.GetRequest().Host)
+
+	var ip net.IP
+	if tcpAddr, isTcp := lAddr.(*net.TCPAddr); isTcp && tcpAddr != nil {
+		ip = tcpAddr.IP
+	} else if localIp, err := result.GetDialer().GetLocalIp(host); err == nil {
+		ip = localIp
+	}
+
+	if ip == nil {
+		return
+	}
+
+	if key, tracked := ips.GetHealthKey(ip, host); tracked {
+		DefaultIpHealth.Report(key, ok)
+	}
+}
@@ -0,0 +1,10 @@
+package prifma
+
+import (
+	"net"
+)
+
+// IpSet is a set of outgoing ips (e.g. ips of "outgoing_ip" of the request)
+type IpSet interface {
+	Contains(ip net.IP) bool
+}
@@ -0,0 +1,73 @@
+package prifma
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type jwtClaimsContextKey struct{}
+
+// WithJwtClaims saves the cache of verified tokens to the context, so the token of the request
+// is verified once for conditions and "jwt_auth"
+func WithJwtClaims(ctx context.Context) context.Context {
+	return context.WithValue(ctx, jwtClaimsContextKey{}, NewJwtClaims())
+}
+
+func GetJwtClaims(req *http.Request) *JwtClaims {
+	claims, _ := req.Context().Value(jwtClaimsContextKey{}).(*JwtClaims)
+
+	return claims
+}
+
+// VerifyRequestJwt verifies the token of the request by the verifier, the result is cached in the request context
+func VerifyRequestJwt(req *http.Request, verifier JwtVerifier, token string) (map[string]interface{}, bool) {
+	if claims := GetJwtClaims(req); claims != nil {
+		return claims.Verify(verifier, token)
+	}
+
+	return verifier.VerifyJwt(token)
+}
+
+type jwtClaimsKey struct {
+	Verifier JwtVerifier
+	Token    string
+}
+
+type jwtClaimsResult struct {
+	Claims map[string]interface{}
+	Ok     bool
+}
+
+// JwtClaims keeps results of verification of tokens by verifiers
+type JwtClaims struct {
+	Results map[jwtClaimsKey]jwtClaimsResult
+	Mutex   *sync.Mutex
+}
+
+func NewJwtClaims() *JwtClaims {
+	return &JwtClaims{
+		Results: make(map[jwtClaimsKey]jwtClaimsResult),
+		Mutex:   new(sync.Mutex),
+	}
+}
+
+func (t *JwtClaims) Verify(verifier JwtVerifier, token string) (map[string]interface{}, bool) {
+	key := jwtClaimsKey{Verifier: verifier, Token: token}
+
+	t.Mutex.Lock()
+	result, ok := t.Results[key]
+	t.Mutex.Unlock()
+
+	if ok {
+		return result.Claims, result.Ok
+	}
+
+	result.Claims, result.Ok = verifier.VerifyJwt(token)
+
+	t.Mutex.Lock()
+	t.Results[key] = result
+	t.Mutex.Unlock()
+
+	return result.Claims, result.Ok
+}
@@ -0,0 +1,58 @@
+package prifma
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+type testJwtVerifier struct {
+	Calls int
+}
+
+func (t *testJwtVerifier) IsJwtEnabled() bool {
+	return true
+}
+
+func (t *testJwtVerifier) VerifyJwt(token string) (map[string]interface{}, bool) {
+	t.Calls++
+
+	if token != "valid" {
+		return nil, false
+	}
+
+	return map[string]interface{}{"pool": "a"}, true
+}
+
+func TestVerifyRequestJwt(t *testing.T) {
+	verifier1 := new(testJwtVerifier)
+	verifier2 := new(testJwtVerifier)
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req = req.WithContext(WithJwtClaims(req.Context()))
+
+	for i := 0; i < 3; i++ {
+		if claims, ok := VerifyRequestJwt(req, verifier1, "valid"); !ok || claims["pool"] != "a" {
+			t.Errorf("valid token: claims = %v, ok = %v", claims, ok)
+		}
+		if _, ok := VerifyRequestJwt(req, verifier1, "wrong"); ok {
+			t.Errorf("wrong token is verified")
+		}
+	}
+	if verifier1.Calls != 2 {
+		t.Errorf("verifier calls = %d, want 2", verifier1.Calls)
+	}
+
+	// tokens are verified by each verifier (e.g. "jwt_auth" of other condition)
+	VerifyRequestJwt(req, verifier2, "valid")
+	if verifier2.Calls != 1 {
+		t.Errorf("other verifier calls = %d, want 1", verifier2.Calls)
+	}
+
+	// without the cache tokens are verified every time
+	req = httptest.NewRequest("GET", "http://example.com/", nil)
+	VerifyRequestJwt(req, verifier2, "valid")
+	VerifyRequestJwt(req, verifier2, "valid")
+	if verifier2.Calls != 3 {
+		t.Errorf("verifier calls without cache = %d, want 3", verifier2.Calls)
+	}
+}
@@ -0,0 +1,148 @@
+package jwtauth
+
+import (
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/prifma/basicauth"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"net/http"
+	"time"
+)
+
+const ModuleDirective = "jwt_auth"
+
+type JwtAuth struct {
+	Keys    []*Key
+	Modules []prifma.Module
+}
+
+func New() *JwtAuth {
+	return new(JwtAuth)
+}
+
+// HandleRequest verifies the token, failures are counted and locked by "basic_auth_lockout" of the context
+func (t *JwtAuth) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	if t.Keys == nil || result.GetAccess() == prifma.AccessGranted {
+		return result, nil
+	}
+
+	req := result.GetRequest()
+	ip := utils.GetHostname(req.RemoteAddr)
+	basicAuth := t.GetBasicAuth()
+
+	if basicAuth != nil && basicAuth.IsLocked(ip, "") {
+		prifma.Metrics.Add("auth_locked_requests", 1)
+		basicAuth.LogFailure(ip, "", "locked")
+		result.SetResponse(prifma.NewResponseError(http.StatusTooManyRequests, ""))
+
+		return result, nil
+	}
+
+	token, ok := utils.ProxyBearerToken(req)
+	if ok {
+		if _, ok = prifma.VerifyRequestJwt(req, t, token); ok {
+			result.SetAccess(prifma.AccessGranted)
+
+			return result, nil
+		}
+
+		if basicAuth != nil {
+			basicAuth.AddFailure(ip, "", "wrong token")
+		}
+	}
+
+	result.SetResponse(basicauth.NewResponseRequireAuth(req))
+
+	return result, nil
+}
+
+// GetBasicAuth returns "basic_auth" module of the context (its lockout is used for tokens)
+func (t *JwtAuth) GetBasicAuth() *basicauth.BasicAuth {
+	for _, module := range t.Modules {
+		if basicAuth, ok := module.(*basicauth.BasicAuth); ok {
+			return basicAuth
+		}
+	}
+
+	return nil
+}
+
+func (t *JwtAuth) IsJwtEnabled() bool {
+	return t.Keys != nil
+}
+
+// VerifyJwt checks the signature by any of keys, the token must have not expired "exp" claim
+func (t *JwtAuth) VerifyJwt(token string) (map[string]interface{}, bool) {
+	for _, key := range t.Keys {
+		claims, err := key.Verify(token)
+		if err != nil {
+			continue
+		}
+
+		return claims, claims.VerifyExpiresAt(time.Now().Unix(), true)
+	}
+
+	return nil, false
+}
+
+func (t *JwtAuth) SetContextModules(modules []prifma.Module) {
+	t.Modules = modules
+}
+
+func (t *JwtAuth) Off() error {
+	t.Keys = nil
+
+	return nil
+}
+
+func (t *JwtAuth) SetKeyFiles(filenames []string) error {
+	keys := make([]*Key, 0, len(filenames))
+
+	for _, filename := range filenames {
+		key, err := LoadKey(filename)
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, key)
+	}
+
+	t.Keys = keys
+
+	return nil
+}
+
+func (t *JwtAuth) GetDirective() string {
+	return ModuleDirective
+}
+
+func (t *JwtAuth) Clone() prifma.Module {
+	clone := *t
+
+	return &clone
+}
+
+func (t *JwtAuth) Call(command conf.Command) (err error) {
+	if command.GetName() != ModuleDirective {
+		return conf.NewErrCommandName(command)
+	}
+
+	args := command.GetArgs()
+	if len(args) == 0 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	if len(args) == 1 && args[0] == "off" {
+		return t.Off()
+	}
+
+	if err = t.SetKeyFiles(args); err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *JwtAuth) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
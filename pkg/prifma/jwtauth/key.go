@@ -0,0 +1,58 @@
+package jwtauth
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"io/ioutil"
+)
+
+type Key struct {
+	Method jwt.SigningMethod
+	Key    interface{}
+}
+
+// LoadKey loads the public key in PEM format (RS256, ES256) or the secret (HS256)
+func LoadKey(filename string) (*Key, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("can't open jwt key file: '%s'", filename)
+	}
+
+	if block, _ := pem.Decode(data); block == nil {
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("empty jwt secret file: '%s'", filename)
+		}
+
+		return &Key{Method: jwt.SigningMethodHS256, Key: secret}, nil
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return &Key{Method: jwt.SigningMethodRS256, Key: key}, nil
+	}
+
+	if key, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return &Key{Method: jwt.SigningMethodES256, Key: key}, nil
+	}
+
+	return nil, fmt.Errorf("wrong jwt key file: '%s'", filename)
+}
+
+func (t *Key) Verify(token string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods: []string{t.Method.Alg()},
+	}
+
+	claims := make(jwt.MapClaims)
+	if _, err := parser.ParseWithClaims(token, claims, t.GetKey); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (t *Key) GetKey(_ *jwt.Token) (interface{}, error) {
+	return t.Key, nil
+}
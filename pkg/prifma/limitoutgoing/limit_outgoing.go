@@ -0,0 +1,239 @@
+package limitoutgoing
+
+import (
+	"context"
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/prifma/outgoingip"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ModuleDirective = "limit_outgoing"
+
+// limitKeyContextKey is the key of the token taken for the request, the request handled again
+// (e.g. after "ssl_preread") with the same outgoing ip doesn't take another token
+type limitKeyContextKey struct{}
+
+// LimitOutgoing limits requests by the outgoing ip and the destination domain.
+// The module must follow modules changing outgoing ips (e.g. "use_ip_header" and "auth_request"),
+// so the token is taken for the ip of the connection.
+type LimitOutgoing struct {
+	Rate     float64 // requests per second, 0 - unlimited
+	Burst    int
+	SwitchIp bool
+	Delay    time.Duration
+	Limiter  *Limiter
+}
+
+func New() *LimitOutgoing {
+	return &LimitOutgoing{
+		Limiter: NewLimiter(),
+	}
+}
+
+func (t *LimitOutgoing) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	if t.Rate != 0 && !t.Limit(result) {
+		result.SetResponse(prifma.NewResponseError(http.StatusTooManyRequests, "outgoing limit exceeded"))
+	}
+
+	return result, nil
+}
+
+// Limit takes a token of the outgoing ip (the range of ips is limited as a whole) and the destination domain.
+// If there are no tokens, switches to another ip of "outgoing_ip" (except session ips and ips requested by headers)
+// or waits for the token. Returns false if the request must be rejected.
+func (t *LimitOutgoing) Limit(result prifma.HandleRequestResult) bool {
+	req := result.GetRequest()
+	dialer := result.GetDialer()
+	domain := utils.GetHostname(req.Host)
+
+	localIp, err := dialer.GetLocalIp(domain)
+	if err != nil {
+		return true
+	}
+
+	// the token is taken for the ip of one address family, so the other family isn't raced by the dialer
+	isV4 := localIp.To4() != nil
+	if isV4 {
+		dialer.SetIpV6(nil)
+	} else {
+		dialer.SetIpV4(nil)
+	}
+
+	selection, _ := result.GetOutgoingIps().(*outgoingip.Selection)
+
+	key := t.GetKey(selection, localIp, domain)
+	if takenKey, _ := req.Context().Value(limitKeyContextKey{}).(string); takenKey == key {
+		return true
+	}
+
+	ok, wait := t.Limiter.Take(key, t.Rate, t.Burst)
+	if ok {
+		t.SetTaken(result, key)
+
+		return true
+	}
+
+	if t.SwitchIp && selection != nil && selection.SessionKey == "" && !selection.Fixed {
+		ipsV4, ips := selection.Pool.Get()
+		if isV4 {
+			ips = ipsV4
+		}
+		ips = selection.OutgoingIp.GetAvailableIps(ips, req)
+
+		for _, i := range rand.Perm(len(ips)) {
+			if ips[i].Contains(localIp) {
+				continue
+			}
+
+			switchedKey := ips[i].String() + " " + domain
+			if ok, _ = t.Limiter.Take(switchedKey, t.Rate, t.Burst); !ok {
+				continue
+			}
+
+			t.SetTaken(result, switchedKey)
+
+			address := ips[i].Get("")
+			if isV4 {
+				dialer.SetIpV4(address)
+			} else {
+				dialer.SetIpV6(address)
+			}
+
+			// ips of ranges may be not assigned to the interface, the address of the range is random
+			dialer.SetFreeBind(ips[i].IsRange())
+			dialer.SetRandomIp(ips[i].IsRange())
+
+			prifma.Metrics.Add("outgoing_limit_switched", 1)
+
+			return true
+		}
+	}
+
+	deadline := time.Now().Add(t.Delay)
+	for !time.Now().Add(wait).After(deadline) {
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+
+			return true
+		}
+
+		if ok, wait = t.Limiter.Take(key, t.Rate, t.Burst); ok {
+			t.SetTaken(result, key)
+			prifma.Metrics.Add("outgoing_limit_delayed", 1)
+
+			return true
+		}
+	}
+
+	prifma.Metrics.Add("outgoing_limit_rejected", 1)
+
+	return false
+}
+
+// GetKey returns the key of the bucket: the item of "outgoing_ip" containing the ip (the ip or the range)
+// and the domain
+func (t *LimitOutgoing) GetKey(selection *outgoingip.Selection, ip net.IP, domain string) string {
+	if selection != nil {
+		if item := selection.Pool.GetIp(ip); item != nil {
+			return item.String() + " " + domain
+		}
+	}
+
+	return ip.String() + " " + domain
+}
+
+// SetTaken marks the request by the key of the taken token
+func (t *LimitOutgoing) SetTaken(result prifma.HandleRequestResult, key string) {
+	req := result.GetRequest()
+
+	result.SetRequest(req.WithContext(context.WithValue(req.Context(), limitKeyContextKey{}, key)))
+}
+
+func (t *LimitOutgoing) Off() error {
+	t.Rate = 0
+
+	return nil
+}
+
+// SetLimit sets the limit, args: rate [burst=N] [switch_ip] [delay=time]
+func (t *LimitOutgoing) SetLimit(args []string) error {
+	rate, err := ParseLimiterRate(args[0])
+	if err != nil {
+		return err
+	}
+
+	burst := 1
+	switchIp := false
+	delay := time.Duration(0)
+
+	for _, arg := range args[1:] {
+		switch true {
+		case strings.HasPrefix(arg, "burst="):
+			if burst, err = strconv.Atoi(arg[len("burst="):]); err != nil || burst < 1 {
+				return fmt.Errorf("wrong burst - '%s'", arg)
+			}
+		case strings.HasPrefix(arg, "delay="):
+			if delay, err = time.ParseDuration(arg[len("delay="):]); err != nil || delay < 0 {
+				return fmt.Errorf("wrong delay - '%s'", arg)
+			}
+		case arg == "switch_ip":
+			switchIp = true
+		default:
+			return fmt.Errorf("wrong argument - '%s'", arg)
+		}
+	}
+
+	t.Rate = rate
+	t.Burst = burst
+	t.SwitchIp = switchIp
+	t.Delay = delay
+
+	return nil
+}
+
+func (t *LimitOutgoing) GetDirective() string {
+	return ModuleDirective
+}
+
+func (t *LimitOutgoing) Clone() prifma.Module {
+	clone := *t
+
+	return &clone
+}
+
+func (t *LimitOutgoing) Call(command conf.Command) (err error) {
+	if command.GetName() != ModuleDirective {
+		return conf.NewErrCommandName(command)
+	}
+
+	args := command.GetArgs()
+	if len(args) == 0 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	if len(args) == 1 && args[0] == "off" {
+		return t.Off()
+	}
+
+	if err = t.SetLimit(args); err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *LimitOutgoing) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
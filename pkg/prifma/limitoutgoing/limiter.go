@@ -0,0 +1,112 @@
+package limitoutgoing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LimiterForgetTime - buckets unused longer are removed (they are full anyway)
+const LimiterForgetTime = time.Hour
+
+type LimiterBucket struct {
+	Tokens float64
+	Last   time.Time
+}
+
+// Limiter is a set of token buckets by key (outgoing ip or range and destination domain)
+type Limiter struct {
+	Buckets   map[string]*LimiterBucket
+	LastSweep time.Time
+	Mutex     *sync.Mutex
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		Buckets:   make(map[string]*LimiterBucket),
+		LastSweep: time.Now(),
+		Mutex:     new(sync.Mutex),
+	}
+}
+
+// Take takes a token from the bucket, if the bucket is empty returns false and time until the next token
+func (t *Limiter) Take(key string, rate float64, burst int) (bool, time.Duration) {
+	now := time.Now()
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.sweep(now)
+
+	bucket, ok := t.Buckets[key]
+	if !ok {
+		bucket = &LimiterBucket{
+			Tokens: float64(burst),
+			Last:   now,
+		}
+		t.Buckets[key] = bucket
+	}
+
+	bucket.Tokens += now.Sub(bucket.Last).Seconds() * rate
+	if bucket.Tokens > float64(burst) {
+		bucket.Tokens = float64(burst)
+	}
+	bucket.Last = now
+
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+
+		return true, 0
+	}
+
+	return false, time.Duration((1 - bucket.Tokens) / rate * float64(time.Second))
+}
+
+func (t *Limiter) sweep(now time.Time) {
+	if now.Sub(t.LastSweep) < LimiterForgetTime {
+		return
+	}
+
+	for key, bucket := range t.Buckets {
+		if now.Sub(bucket.Last) > LimiterForgetTime {
+			delete(t.Buckets, key)
+		}
+	}
+
+	t.LastSweep = now
+}
+
+// ParseLimiterRate parses rate in requests per second from "Nr/s", "Nr/m" or "Nr/h".
+// The rate must be at least 1r/h, buckets of slower rates would be forgotten before the next token.
+func ParseLimiterRate(val string) (float64, error) {
+	i := strings.Index(val, "r/")
+	if i < 1 {
+		return 0, fmt.Errorf("wrong rate - '%s'", val)
+	}
+
+	count, err := strconv.ParseFloat(val[:i], 64)
+	if err != nil || math.IsNaN(count) || math.IsInf(count, 0) || count <= 0 {
+		return 0, fmt.Errorf("wrong rate - '%s'", val)
+	}
+
+	var seconds float64
+	switch val[i+2:] {
+	case "s":
+		seconds = 1
+	case "m":
+		seconds = 60
+	case "h":
+		seconds = 3600
+	default:
+		return 0, fmt.Errorf("wrong rate - '%s'", val)
+	}
+
+	if count*(3600/seconds) < 1 {
+		return 0, fmt.Errorf("rate is less than 1r/h - '%s'", val)
+	}
+
+	return count / seconds, nil
+}
@@ -0,0 +1,65 @@
+package prifma
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Metrics are served in JSON format by the server "metrics_listen" directive
+var Metrics = NewMetricsMap()
+
+// MetricsMap is a set of counters and values computed on output.
+// Unlike expvar it doesn't publish process variables (e.g. cmdline) and doesn't register handlers.
+type MetricsMap struct {
+	Counters map[string]int64
+	Funcs    map[string]func() interface{}
+	Mutex    *sync.Mutex
+}
+
+func NewMetricsMap() *MetricsMap {
+	return &MetricsMap{
+		Counters: make(map[string]int64),
+		Funcs:    make(map[string]func() interface{}),
+		Mutex:    new(sync.Mutex),
+	}
+}
+
+func (t *MetricsMap) Add(key string, delta int64) {
+	t.Mutex.Lock()
+	t.Counters[key] += delta
+	t.Mutex.Unlock()
+}
+
+// SetFunc sets the value computed on output
+func (t *MetricsMap) SetFunc(key string, f func() interface{}) {
+	t.Mutex.Lock()
+	t.Funcs[key] = f
+	t.Mutex.Unlock()
+}
+
+func (t *MetricsMap) Get() map[string]interface{} {
+	t.Mutex.Lock()
+	values := make(map[string]interface{}, len(t.Counters)+len(t.Funcs))
+	for key, val := range t.Counters {
+		values[key] = val
+	}
+	funcs := make(map[string]func() interface{}, len(t.Funcs))
+	for key, f := range t.Funcs {
+		funcs[key] = f
+	}
+	t.Mutex.Unlock()
+
+	// functions may lock other mutexes
+	for key, f := range funcs {
+		values[key] = f()
+	}
+
+	return values
+}
+
+func (t *MetricsMap) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	_ = json.NewEncoder(w).Encode(t.Get())
+}
@@ -12,6 +12,40 @@ type Module interface {
 	conf.Block
 }
 
+// DirectivesModule handles several directives, GetDirectives must contain the directive of GetDirective
+type DirectivesModule interface {
+	GetDirectives() []string
+}
+
+// DialerModule sets options of the dialer used to resolve destinations (e.g. DNS servers),
+// the options are also used by conditions resolving the destination
+type DialerModule interface {
+	SetupDialer(dialer Dialer)
+}
+
+// ContextModule gets modules of its context (the main context or the condition) to cooperate with them,
+// modules are set again for clones of the module
+type ContextModule interface {
+	SetContextModules(modules []Module)
+}
+
+// JwtVerifier verifies proxy bearer tokens (see "jwt_auth"), returns claims of the valid token
+type JwtVerifier interface {
+	IsJwtEnabled() bool
+	VerifyJwt(token string) (map[string]interface{}, bool)
+}
+
+// GetJwtVerifier returns the enabled jwt verifier of modules or nil
+func GetJwtVerifier(modules []Module) JwtVerifier {
+	for _, module := range modules {
+		if verifier, ok := module.(JwtVerifier); ok && verifier.IsJwtEnabled() {
+			return verifier
+		}
+	}
+
+	return nil
+}
+
 type BeforeHandleRequestModule interface {
 	BeforeHandleRequest(req *http.Request) error
 }
@@ -4,6 +4,7 @@ import "net/http"
 
 type ModulesManager interface {
 	GetModule(directive string, conds ...Condition) Module
+	GetModules(conds ...Condition) []Module
 	GetModulesForRequest(req *http.Request) []Module
 }
 
@@ -11,6 +12,16 @@ func NewModulesManager(modules ...Module) *DefaultModulesManager {
 	mainModulesMap := make(map[string]int, len(modules))
 	for i, module := range modules {
 		mainModulesMap[module.GetDirective()] = i
+
+		if directivesModule, ok := module.(DirectivesModule); ok {
+			for _, directive := range directivesModule.GetDirectives() {
+				mainModulesMap[directive] = i
+			}
+		}
+
+		if contextModule, ok := module.(ContextModule); ok {
+			contextModule.SetContextModules(modules)
+		}
 	}
 
 	return &DefaultModulesManager{
@@ -31,9 +42,11 @@ func (t *DefaultModulesManager) GetModule(directive string, conds ...Condition)
 		return t.ModulesArray[t.ModulesMap[directive]]
 	}
 
-	cond := conds[0]
-	conds = conds[1:]
+	return t.getCondModules(conds[0]).GetModule(directive, conds[1:]...)
+}
 
+// getCondModules returns modules of the condition, modules are cloned on the first call
+func (t *DefaultModulesManager) getCondModules(cond Condition) ModulesManager {
 	if _, ok := t.CondModules[cond]; !ok {
 		modules := make([]Module, len(t.ModulesArray))
 		for i, module := range t.ModulesArray {
@@ -43,7 +56,16 @@ func (t *DefaultModulesManager) GetModule(directive string, conds ...Condition)
 		t.CondModules[cond] = NewModulesManager(modules...)
 	}
 
-	return t.CondModules[cond].GetModule(directive, conds...)
+	return t.CondModules[cond]
+}
+
+// GetModules returns modules of the context of conditions
+func (t *DefaultModulesManager) GetModules(conds ...Condition) []Module {
+	if len(conds) == 0 {
+		return t.ModulesArray
+	}
+
+	return t.getCondModules(conds[0]).GetModules(conds[1:]...)
 }
 
 func (t *DefaultModulesManager) GetModulesForRequest(req *http.Request) []Module {
@@ -0,0 +1,31 @@
+package prifma
+
+import (
+	"net"
+	"net/http"
+)
+
+const (
+	HeaderOutgoingIp    = "X-Prifma-Outgoing-Ip"
+	HeaderOutgoingProxy = "X-Prifma-Outgoing-Proxy"
+)
+
+// SetOutgoingIpHeader adds the outgoing ip and the upstream proxy (without credentials) to the response header
+// if "expose_outgoing_ip" is enabled
+func SetOutgoingIpHeader(header http.Header, result HandleRequestResult, lAddr net.Addr) {
+	if !result.GetExposeOutgoingIp() {
+		return
+	}
+
+	if tcpAddr, ok := lAddr.(*net.TCPAddr); ok && tcpAddr != nil {
+		header.Set(HeaderOutgoingIp, tcpAddr.IP.String())
+	}
+
+	if result.GetProxy() == nil {
+		return
+	}
+
+	if proxyUrl, err := result.GetProxy()(result.GetRequest()); err == nil && proxyUrl != nil {
+		header.Set(HeaderOutgoingProxy, proxyUrl.Scheme+"://"+proxyUrl.Host)
+	}
+}
@@ -0,0 +1,111 @@
+package outgoingiface
+
+import (
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const ModuleDirective = "outgoing_interface"
+
+const markPrefix = "mark="
+
+// OutgoingInterface binds outgoing connections to the network interface (SO_BINDTODEVICE)
+// and sets the firewall mark (SO_MARK) for policy routing
+type OutgoingInterface struct {
+	Name string
+	Mark int
+}
+
+func New() *OutgoingInterface {
+	return new(OutgoingInterface)
+}
+
+func (t *OutgoingInterface) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	if t.Name == "" && t.Mark == 0 {
+		return result, nil
+	}
+
+	result.GetDialer().SetInterface(t.Name)
+	result.GetDialer().SetMark(t.Mark)
+
+	return result, nil
+}
+
+func (t *OutgoingInterface) Off() error {
+	t.Name = ""
+	t.Mark = 0
+
+	return nil
+}
+
+// SetInterface sets the interface and the mark, args: name [mark=N] | mark=N
+func (t *OutgoingInterface) SetInterface(args []string) error {
+	name := ""
+	mark := 0
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, markPrefix) {
+			value, err := strconv.ParseUint(arg[len(markPrefix):], 0, 32)
+			if err != nil || value == 0 {
+				return fmt.Errorf("wrong mark - '%s'", arg)
+			}
+
+			mark = int(value)
+
+			continue
+		}
+
+		if name != "" {
+			return fmt.Errorf("interface is already set - '%s'", arg)
+		}
+		if _, err := net.InterfaceByName(arg); err != nil {
+			return fmt.Errorf("wrong interface - '%s'", arg)
+		}
+
+		name = arg
+	}
+
+	t.Name = name
+	t.Mark = mark
+
+	return nil
+}
+
+func (t *OutgoingInterface) GetDirective() string {
+	return ModuleDirective
+}
+
+func (t *OutgoingInterface) Clone() prifma.Module {
+	clone := *t
+
+	return &clone
+}
+
+func (t *OutgoingInterface) Call(command conf.Command) (err error) {
+	if command.GetName() != ModuleDirective {
+		return conf.NewErrCommandName(command)
+	}
+
+	args := command.GetArgs()
+	if len(args) == 0 || len(args) > 2 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	if len(args) == 1 && args[0] == "off" {
+		return t.Off()
+	}
+
+	if err = t.SetInterface(args); err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *OutgoingInterface) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
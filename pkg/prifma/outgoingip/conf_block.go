@@ -5,7 +5,7 @@ import (
 )
 
 type IpArray interface {
-	AddIp(ip string) error
+	AddIps(args []string) error
 }
 
 type ConfBlock struct {
@@ -19,11 +19,11 @@ func NewConfBlock(ipArray IpArray) *ConfBlock {
 }
 
 func (t *ConfBlock) Call(command conf.Command) (err error) {
-	if len(command.GetArgs()) != 0 {
+	if len(command.GetArgs()) > 1 {
 		return conf.NewErrCommandArgsNumber(command)
 	}
 
-	if err = t.IpArray.AddIp(command.GetName()); err != nil {
+	if err = t.IpArray.AddIps(append([]string{command.GetName()}, command.GetArgs()...)); err != nil {
 		err = conf.NewErrCommand(command, err.Error())
 	}
 
@@ -0,0 +1,151 @@
+package outgoingip
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+// Ip is a single outgoing ip or a range of ips (CIDR or "first-last")
+type Ip struct {
+	Ip     net.IP // the first ip of the range
+	Last   net.IP // the last ip of the range, nil for a single ip
+	Weight int
+}
+
+func NewIp(ip net.IP, weight int) *Ip {
+	return &Ip{
+		Ip:     ip,
+		Weight: weight,
+	}
+}
+
+func NewIpRange(first net.IP, last net.IP, weight int) *Ip {
+	return &Ip{
+		Ip:     first,
+		Last:   last,
+		Weight: weight,
+	}
+}
+
+// ParseIp parses ip, CIDR (e.g. "2001:db8::/64") or range (e.g. "10.0.0.10-10.0.0.20").
+// Network and broadcast addresses of IPv4 CIDR are excluded.
+func ParseIp(val string, weight int) (*Ip, error) {
+	switch true {
+	case strings.ContainsRune(val, '/'):
+		ip, ipNet, err := net.ParseCIDR(val)
+		if err != nil {
+			return nil, fmt.Errorf("wrong outgoing ip network - '%s'", val)
+		}
+
+		first := normalizeIp(ipNet.IP)
+		last := make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^ipNet.Mask[i]
+		}
+
+		if ones, bits := ipNet.Mask.Size(); ip.To4() != nil && bits-ones > 1 {
+			first = addIp(first, big.NewInt(1))
+			last = addIp(last, big.NewInt(-1))
+		}
+
+		return newIpOrRange(first, last, weight), nil
+	case strings.ContainsRune(val, '-'):
+		i := strings.IndexByte(val, '-')
+		first := normalizeIp(net.ParseIP(val[:i]))
+		last := normalizeIp(net.ParseIP(val[i+1:]))
+
+		if first == nil || last == nil || len(first) != len(last) || bytes.Compare(first, last) > 0 {
+			return nil, fmt.Errorf("wrong outgoing ip range - '%s'", val)
+		}
+
+		return newIpOrRange(first, last, weight), nil
+	}
+
+	ip := normalizeIp(net.ParseIP(val))
+	if ip == nil {
+		return nil, fmt.Errorf("wrong outgoing ip - '%s'", val)
+	}
+
+	return NewIp(ip, weight), nil
+}
+
+func (t *Ip) IsRange() bool {
+	return t.Last != nil
+}
+
+// Get returns the ip, for a range - random ip or ip selected by the key hash if the key is not empty
+func (t *Ip) Get(key string) net.IP {
+	if !t.IsRange() {
+		return t.Ip
+	}
+
+	size := new(big.Int).Sub(new(big.Int).SetBytes(t.Last), new(big.Int).SetBytes(t.Ip))
+	size.Add(size, big.NewInt(1))
+
+	var n []byte
+	if key == "" {
+		n = make([]byte, len(t.Ip))
+		_, _ = rand.Read(n)
+	} else {
+		hash := fnv.New128a()
+		_, _ = hash.Write([]byte(key))
+		n = hash.Sum(nil)
+	}
+
+	return addIp(t.Ip, new(big.Int).Mod(new(big.Int).SetBytes(n), size))
+}
+
+func (t *Ip) String() string {
+	if !t.IsRange() {
+		return t.Ip.String()
+	}
+
+	return t.Ip.String() + "-" + t.Last.String()
+}
+
+func newIpOrRange(first net.IP, last net.IP, weight int) *Ip {
+	if first.Equal(last) {
+		return NewIp(first, weight)
+	}
+
+	return NewIpRange(first, last, weight)
+}
+
+func normalizeIp(ip net.IP) net.IP {
+	if ipV4 := ip.To4(); ipV4 != nil {
+		return ipV4
+	}
+
+	return ip
+}
+
+func addIp(ip net.IP, n *big.Int) net.IP {
+	sum := new(big.Int).Add(new(big.Int).SetBytes(ip), n).Bytes()
+	result := make(net.IP, len(ip))
+	copy(result[len(result)-len(sum):], sum)
+
+	return result
+}
+
+func (t *Ip) Contains(ip net.IP) bool {
+	ip = normalizeIp(ip)
+	if len(ip) != len(t.Ip) {
+		return false
+	}
+
+	if !t.IsRange() {
+		return ip.Equal(t.Ip)
+	}
+
+	return bytes.Compare(ip, t.Ip) >= 0 && bytes.Compare(ip, t.Last) <= 0
+}
+
+// Equal compares ips and ranges (e.g. after reload of the pool)
+func (t *Ip) Equal(ip *Ip) bool {
+	return t.Ip.Equal(ip.Ip) && t.Last.Equal(ip.Last)
+}
@@ -0,0 +1,243 @@
+package outgoingip
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseIp(t *testing.T) {
+	tests := []struct {
+		val   string
+		first string
+		last  string // empty for a single ip
+		size  int    // length of ips
+		err   bool
+	}{
+		{val: "10.0.0.1", first: "10.0.0.1", size: net.IPv4len},
+		{val: "::ffff:10.0.0.1", first: "10.0.0.1", size: net.IPv4len},
+		{val: "2001:db8::1", first: "2001:db8::1", size: net.IPv6len},
+		{val: "10.0.0.0/24", first: "10.0.0.1", last: "10.0.0.254", size: net.IPv4len},
+		{val: "10.0.0.77/24", first: "10.0.0.1", last: "10.0.0.254", size: net.IPv4len},
+		{val: "10.0.0.0/30", first: "10.0.0.1", last: "10.0.0.2", size: net.IPv4len},
+		{val: "10.0.0.0/31", first: "10.0.0.0", last: "10.0.0.1", size: net.IPv4len},
+		{val: "10.0.0.1/32", first: "10.0.0.1", size: net.IPv4len},
+		{val: "2001:db8::/64", first: "2001:db8::", last: "2001:db8::ffff:ffff:ffff:ffff", size: net.IPv6len},
+		{val: "2001:db8::1/128", first: "2001:db8::1", size: net.IPv6len},
+		{val: "10.0.0.10-10.0.0.20", first: "10.0.0.10", last: "10.0.0.20", size: net.IPv4len},
+		{val: "10.0.0.10-10.0.0.10", first: "10.0.0.10", size: net.IPv4len},
+		{val: "10.0.0.250-10.0.1.5", first: "10.0.0.250", last: "10.0.1.5", size: net.IPv4len},
+		{val: "2001:db8::1-2001:db8::ff", first: "2001:db8::1", last: "2001:db8::ff", size: net.IPv6len},
+		{val: "10.0.0.20-10.0.0.10", err: true},
+		{val: "10.0.0.1-2001:db8::1", err: true},
+		{val: "10.0.0.1-", err: true},
+		{val: "10.0.0.0/33", err: true},
+		{val: "10.0.0.256", err: true},
+		{val: "example.com", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.val, func(t *testing.T) {
+			ip, err := ParseIp(test.val, 2)
+			if test.err {
+				if err == nil {
+					t.Errorf("ParseIp returned %s, want error", ip)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ip.Ip.Equal(net.ParseIP(test.first)) || len(ip.Ip) != test.size {
+				t.Errorf("first = %s (%d bytes), want %s (%d bytes)", ip.Ip, len(ip.Ip), test.first, test.size)
+			}
+			if ip.IsRange() != (test.last != "") {
+				t.Fatalf("range = %v, want %v", ip.IsRange(), test.last != "")
+			}
+			if ip.IsRange() && (!ip.Last.Equal(net.ParseIP(test.last)) || len(ip.Last) != test.size) {
+				t.Errorf("last = %s (%d bytes), want %s (%d bytes)", ip.Last, len(ip.Last), test.last, test.size)
+			}
+			if ip.Weight != 2 {
+				t.Errorf("weight = %d, want 2", ip.Weight)
+			}
+		})
+	}
+}
+
+func TestIpContains(t *testing.T) {
+	tests := []struct {
+		val  string
+		ip   string
+		want bool
+	}{
+		{val: "10.0.0.1", ip: "10.0.0.1", want: true},
+		{val: "10.0.0.1", ip: "::ffff:10.0.0.1", want: true},
+		{val: "10.0.0.1", ip: "10.0.0.2", want: false},
+		{val: "10.0.0.0/24", ip: "10.0.0.1", want: true},
+		{val: "10.0.0.0/24", ip: "10.0.0.254", want: true},
+		{val: "10.0.0.0/24", ip: "10.0.0.0", want: false},
+		{val: "10.0.0.0/24", ip: "10.0.0.255", want: false},
+		{val: "10.0.0.10-10.0.0.20", ip: "::ffff:10.0.0.15", want: true},
+		{val: "10.0.0.10-10.0.0.20", ip: "10.0.0.21", want: false},
+		{val: "10.0.0.0/24", ip: "::a00:1", want: false},
+		{val: "::/96", ip: "10.0.0.1", want: false},
+		{val: "2001:db8::/64", ip: "2001:db8::1:2:3:4", want: true},
+		{val: "2001:db8::/64", ip: "2001:db8:0:1::", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.val+" "+test.ip, func(t *testing.T) {
+			ip, err := ParseIp(test.val, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := ip.Contains(net.ParseIP(test.ip)); got != test.want {
+				t.Errorf("Contains = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIpGet(t *testing.T) {
+	tests := []struct {
+		val     string
+		size    int // number of ips
+		samples int
+	}{
+		{val: "10.0.0.1", size: 1, samples: 10},
+		{val: "10.0.0.0/30", size: 2, samples: 100},
+		{val: "10.0.0.250-10.0.1.5", size: 12, samples: 1000},
+		{val: "2001:db8::/126", size: 4, samples: 100},
+		{val: "2001:db8::/64", samples: 100},
+	}
+
+	for _, test := range tests {
+		t.Run(test.val, func(t *testing.T) {
+			ip, err := ParseIp(test.val, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ips := make(map[string]bool)
+			for i := 0; i < test.samples; i++ {
+				address := ip.Get("")
+				if !ip.Contains(address) || len(address) != len(ip.Ip) {
+					t.Fatalf("Get returned %s out of %s", address, ip)
+				}
+
+				ips[address.String()] = true
+			}
+
+			// all ips of small ranges are sampled, ips of large ranges are not repeated
+			if test.size != 0 && len(ips) != test.size {
+				t.Errorf("sampled %d ips, want %d", len(ips), test.size)
+			}
+			if test.size == 0 && len(ips) != test.samples {
+				t.Errorf("sampled %d different ips of %d", len(ips), test.samples)
+			}
+
+			keyIps := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key%d", i)
+
+				address := ip.Get(key)
+				if !ip.Contains(address) {
+					t.Fatalf("Get(%s) returned %s out of %s", key, address, ip)
+				}
+				if !address.Equal(ip.Get(key)) {
+					t.Fatalf("Get(%s) returned different ips", key)
+				}
+
+				keyIps[address.String()] = true
+			}
+
+			if test.size > 1 && len(keyIps) == 1 {
+				t.Errorf("all keys got the same ip")
+			}
+		})
+	}
+}
+
+func TestStrategyStickyStability(t *testing.T) {
+	strategy, err := NewStrategySticky(StickyKeyDstDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parseIps := func(vals ...string) []*Ip {
+		ips := make([]*Ip, 0, len(vals))
+		for _, val := range vals {
+			ip, err := ParseIp(val, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ips = append(ips, ip)
+		}
+
+		return ips
+	}
+
+	selectIps := func(ips []*Ip) map[string]*Ip {
+		selected := make(map[string]*Ip)
+		for i := 0; i < 1000; i++ {
+			host := fmt.Sprintf("host%d.example.com", i)
+			selected[host] = strategy.Select("", ips, httptest.NewRequest("GET", "http://"+host+"/", nil))
+		}
+
+		return selected
+	}
+
+	ips := parseIps("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4")
+	selected := selectIps(ips)
+
+	// the same key selects the same ip regardless of the order of ips
+	reversed := []*Ip{ips[3], ips[2], ips[1], ips[0]}
+	for host, ip := range selectIps(reversed) {
+		if ip != selected[host] {
+			t.Fatalf("%s: %s selected after reordering, want %s", host, ip, selected[host])
+		}
+	}
+
+	// only keys of the removed ip are remapped
+	removed := ips[1]
+	for host, ip := range selectIps([]*Ip{ips[0], ips[2], ips[3]}) {
+		if selected[host] != removed && ip != selected[host] {
+			t.Errorf("%s: %s selected after removing %s, want %s", host, ip, removed, selected[host])
+		}
+	}
+
+	// keys are remapped only to the added ip
+	added := parseIps("10.0.0.5")[0]
+	moved := 0
+	for host, ip := range selectIps(append(ips[:4:4], added)) {
+		if ip != selected[host] {
+			moved++
+
+			if ip != added {
+				t.Errorf("%s: %s selected after adding %s, want %s or %s", host, ip, added, selected[host], added)
+			}
+		}
+	}
+	if moved < 100 || moved > 300 {
+		t.Errorf("%d of 1000 keys moved to the added ip, want about 200", moved)
+	}
+
+	// keys are distributed by weights
+	weighted := parseIps("10.0.0.1", "10.0.0.2")
+	weighted[1].Weight = 3
+
+	count := 0
+	for _, ip := range selectIps(weighted) {
+		if ip == weighted[1] {
+			count++
+		}
+	}
+	if count < 700 || count > 800 {
+		t.Errorf("%d of 1000 keys selected the ip with weight 3, want about 750", count)
+	}
+}
@@ -4,77 +4,294 @@ import (
 	"fmt"
 	"github.com/topvisor/go-prifma/pkg/conf"
 	"github.com/topvisor/go-prifma/pkg/prifma"
-	"math/rand"
+	"github.com/topvisor/go-prifma/pkg/utils"
 	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-const ModuleDirective = "outgoing_ip"
+const (
+	ModuleDirective           = "outgoing_ip"
+	ModuleDirectiveStrategy   = "outgoing_ip_strategy"
+	ModuleDirectiveSessionTtl = "outgoing_ip_session_ttl"
+	ModuleDirectiveHealth     = "outgoing_ip_health"
+	ModuleDirectivePool       = "ip_pool"
+	ModuleDirectiveIpFamily   = "ip_family"
+)
+
+const (
+	HeaderSessionId = "Proxy-Session-Id"
+	HeaderSessionIp = "X-Prifma-Session-Ip"
+)
+
+const weightPrefix = "weight="
 
 type OutgoingIp struct {
-	IpsV4 []net.IP
-	IpsV6 []net.IP
+	Pool        *Pool
+	InCondition bool
+
+	IpFamily   prifma.IpFamily
+	Strategy   Strategy
+	SessionTtl time.Duration
+	Sessions   *Sessions
+
+	HealthThreshold int // 0 - ips are selected regardless of failures
+	HealthCooldown  time.Duration
+	HealthPerDomain bool
 }
 
 func New() *OutgoingIp {
 	return &OutgoingIp{
-		IpsV4: make([]net.IP, 0),
-		IpsV6: make([]net.IP, 0),
+		Pool:     NewPool(""),
+		Strategy: NewStrategyRandom(),
+		Sessions: NewSessions(),
 	}
 }
 
 func (t *OutgoingIp) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
-	ipsV4Len := len(t.IpsV4)
-	ipsV6Len := len(t.IpsV6)
+	result.GetDialer().SetIpFamily(t.IpFamily)
+
+	return result, t.Apply(result, t.Pool)
+}
+
+// Apply selects outgoing ips of the pool by the strategy, health and sessions of the module
+// (the pool of the module or the pool requested by headers)
+func (t *OutgoingIp) Apply(result prifma.HandleRequestResult, pool *Pool) error {
+	req := result.GetRequest()
+	sessionKey := t.GetSessionKey(req)
+
+	result.SetOutgoingIps(NewSelection(t, pool, sessionKey))
+
+	ipsV4, ipsV6 := pool.Get()
+	ipsV4Len := len(ipsV4)
+	ipsV6Len := len(ipsV6)
 
 	if ipsV4Len == 0 && ipsV6Len == 0 {
-		return result, nil
+		return pool.PopError()
 	}
 
+	sessionIps := make([]string, 0, 2)
+
+	freeBind := false
+	randomIp := false
+
 	result.GetDialer().SetIpV4(nil)
 	result.GetDialer().SetIpV6(nil)
 
 	if ipsV4Len != 0 {
-		result.GetDialer().SetIpV4(t.IpsV4[rand.Intn(ipsV4Len)])
+		ip, address := t.SelectIp(pool.Name+" v4", t.GetAvailableIps(ipsV4, req), req, sessionKey)
+		result.GetDialer().SetIpV4(address)
+		sessionIps = append(sessionIps, address.String())
+		freeBind = freeBind || ip.IsRange()
+		randomIp = randomIp || t.IsRandom(ip, sessionKey)
 	}
 	if ipsV6Len != 0 {
-		result.GetDialer().SetIpV6(t.IpsV6[rand.Intn(ipsV6Len)])
+		ip, address := t.SelectIp(pool.Name+" v6", t.GetAvailableIps(ipsV6, req), req, sessionKey)
+		result.GetDialer().SetIpV6(address)
+		sessionIps = append(sessionIps, address.String())
+		freeBind = freeBind || ip.IsRange()
+		randomIp = randomIp || t.IsRandom(ip, sessionKey)
+	}
+
+	// ips of ranges may be not assigned to the interface
+	result.GetDialer().SetFreeBind(freeBind)
+	result.GetDialer().SetRandomIp(randomIp)
+
+	if sessionKey != "" {
+		result.GetResponseHeader().Set(HeaderSessionIp, strings.Join(sessionIps, ", "))
+	}
+
+	return pool.PopError()
+}
+
+// SelectIp selects ip by the strategy, if the session key is set - ip bound to the session.
+// The list identifies ips (pool and address family) for the strategy and sessions.
+// Returns the selected item of ips and the address (random address of the range)
+func (t *OutgoingIp) SelectIp(list string, ips []*Ip, req *http.Request, sessionKey string) (*Ip, net.IP) {
+	selectIp := func() (*Ip, net.IP) {
+		key := ""
+		if strategy, ok := t.Strategy.(StrategyKey); ok {
+			key = strategy.GetKey(req)
+		}
+
+		ip := t.Strategy.Select(list, ips, req)
+
+		return ip, ip.Get(key)
+	}
+
+	if sessionKey == "" {
+		return selectIp()
+	}
+
+	// ipv4 and ipv6 are bound separately
+	return t.Sessions.Get(sessionKey+"\x00"+list, ips, t.SessionTtl, selectIp)
+}
+
+// IsRandom returns true if the address of the ip is random for each request (the range without a key or a session)
+func (t *OutgoingIp) IsRandom(ip *Ip, sessionKey string) bool {
+	if !ip.IsRange() || sessionKey != "" {
+		return false
+	}
+
+	_, ok := t.Strategy.(StrategyKey)
+
+	return !ok
+}
+
+// GetAvailableIps returns ips without ips in the cooldown after failures (see "outgoing_ip_health").
+// If all ips are in the cooldown, returns all ips.
+func (t *OutgoingIp) GetAvailableIps(ips []*Ip, req *http.Request) []*Ip {
+	if t.HealthThreshold == 0 {
+		return ips
+	}
+
+	domain := utils.GetHostname(req.Host)
+
+	availableIps := make([]*Ip, 0, len(ips))
+	for _, ip := range ips {
+		if prifma.DefaultIpHealth.IsAvailable(t.GetHealthKey(ip, domain), t.HealthThreshold, t.HealthCooldown) {
+			availableIps = append(availableIps, ip)
+		}
+	}
+
+	if len(availableIps) == 0 {
+		return ips
+	}
+
+	if skipped := len(ips) - len(availableIps); skipped != 0 {
+		prifma.Metrics.Add("outgoing_ip_cooldown_skips", int64(skipped))
+	}
+
+	return availableIps
+}
+
+// GetHealthKey returns the key of failures of the ip (the range is counted as a whole)
+func (t *OutgoingIp) GetHealthKey(ip *Ip, domain string) string {
+	if t.HealthPerDomain {
+		return ip.String() + " " + domain
+	}
+
+	return ip.String()
+}
+
+// GetSessionKey returns the key of "Proxy-Session-Id" session of the user (or client ip without authorization)
+func (t *OutgoingIp) GetSessionKey(req *http.Request) string {
+	if t.SessionTtl == 0 {
+		return ""
+	}
+
+	sessionId := req.Header.Get(HeaderSessionId)
+	if sessionId == "" {
+		return ""
 	}
 
-	return result, nil
+	user, _, ok := utils.ProxyBasicAuth(req)
+	if !ok {
+		user = utils.GetHostname(req.RemoteAddr)
+	}
+
+	return user + "\x00" + sessionId
 }
 
 func (t *OutgoingIp) Off() error {
-	t.IpsV4 = make([]net.IP, 0)
-	t.IpsV6 = make([]net.IP, 0)
+	t.Pool = NewPool("")
 
 	return nil
 }
 
-func (t *OutgoingIp) SetIps(ips []string) error {
-	t.IpsV4 = make([]net.IP, 0, len(ips))
-	t.IpsV6 = make([]net.IP, 0, len(ips))
+// SetIps sets ips from arguments (argument "weight=N" sets weight of the previous ip) or the named pool "pool:name"
+func (t *OutgoingIp) SetIps(args []string) error {
+	pool, err := DefaultPools.GetByValue(args[0])
+	if err != nil {
+		return err
+	}
 
-	for _, ip := range ips {
-		if err := t.AddIp(ip); err != nil {
-			return err
+	if pool != nil {
+		if len(args) != 1 {
+			return fmt.Errorf("ip pool can't be used with ips")
 		}
+
+		t.Pool = pool
+
+		return nil
+	}
+
+	t.Pool = NewPool("")
+
+	return t.Pool.AddIps(args)
+}
+
+// SetPool defines the named pool by the file: name path
+func (t *OutgoingIp) SetPool(args []string) error {
+	if t.InCondition {
+		return fmt.Errorf("ip pool can be defined only in main context")
+	}
+
+	pool := NewPool(args[0])
+	if err := pool.LoadFile(args[1]); err != nil {
+		return err
+	}
+
+	return DefaultPools.Add(pool)
+}
+
+func (t *OutgoingIp) SetIpFamily(name string) (err error) {
+	t.IpFamily, err = prifma.ParseIpFamily(name)
+
+	return err
+}
+
+func (t *OutgoingIp) SetStrategy(args []string) (err error) {
+	t.Strategy, err = NewStrategy(args[0], args[1:])
+
+	return err
+}
+
+func (t *OutgoingIp) SetSessionTtl(ttl string) error {
+	if ttl == "off" {
+		t.SessionTtl = 0
+
+		return nil
+	}
+
+	duration, err := time.ParseDuration(ttl)
+	if err != nil || duration < 0 {
+		return fmt.Errorf("wrong session ttl - '%s'", ttl)
 	}
 
+	t.SessionTtl = duration
+
 	return nil
 }
 
-func (t *OutgoingIp) AddIp(ipStr string) error {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return fmt.Errorf("wrong outgoing ip - '%s'", ipStr)
+// SetHealth sets threshold of consecutive failures and cooldown, args: threshold cooldown [per_domain] | off
+func (t *OutgoingIp) SetHealth(args []string) error {
+	if len(args) == 1 && args[0] == "off" {
+		t.HealthThreshold = 0
+
+		return nil
 	}
 
-	if ipV4 := ip.To4(); ipV4 != nil {
-		t.IpsV4 = append(t.IpsV4, ipV4)
-	} else {
-		t.IpsV6 = append(t.IpsV6, ip)
+	if len(args) != 2 && (len(args) != 3 || args[2] != "per_domain") {
+		return fmt.Errorf("wrong health arguments")
 	}
 
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil || threshold < 1 {
+		return fmt.Errorf("wrong health threshold - '%s'", args[0])
+	}
+
+	cooldown, err := time.ParseDuration(args[1])
+	if err != nil || cooldown <= 0 {
+		return fmt.Errorf("wrong health cooldown - '%s'", args[1])
+	}
+
+	t.HealthThreshold = threshold
+	t.HealthCooldown = cooldown
+	t.HealthPerDomain = len(args) == 3
+
 	return nil
 }
 
@@ -82,27 +299,57 @@ func (t *OutgoingIp) GetDirective() string {
 	return ModuleDirective
 }
 
+func (t *OutgoingIp) GetDirectives() []string {
+	return []string{ModuleDirective, ModuleDirectiveStrategy, ModuleDirectiveSessionTtl, ModuleDirectiveHealth, ModuleDirectivePool, ModuleDirectiveIpFamily}
+}
+
 func (t *OutgoingIp) Clone() prifma.Module {
 	clone := *t
+	clone.InCondition = true
 
 	return &clone
 }
 
 func (t *OutgoingIp) Call(command conf.Command) (err error) {
-	if command.GetName() != ModuleDirective {
-		return conf.NewErrCommandName(command)
-	}
-
 	args := command.GetArgs()
 	if len(args) == 0 {
 		return conf.NewErrCommandArgsNumber(command)
 	}
 
-	if len(args) == 1 && args[0] == "off" {
-		return t.Off()
+	switch command.GetName() {
+	case ModuleDirective:
+		if len(args) == 1 && args[0] == "off" {
+			return t.Off()
+		}
+
+		err = t.SetIps(args)
+	case ModuleDirectiveStrategy:
+		err = t.SetStrategy(args)
+	case ModuleDirectiveSessionTtl:
+		if len(args) != 1 {
+			return conf.NewErrCommandArgsNumber(command)
+		}
+
+		err = t.SetSessionTtl(args[0])
+	case ModuleDirectiveHealth:
+		err = t.SetHealth(args)
+	case ModuleDirectivePool:
+		if len(args) != 2 {
+			return conf.NewErrCommandArgsNumber(command)
+		}
+
+		err = t.SetPool(args)
+	case ModuleDirectiveIpFamily:
+		if len(args) != 1 {
+			return conf.NewErrCommandArgsNumber(command)
+		}
+
+		err = t.SetIpFamily(args[0])
+	default:
+		return conf.NewErrCommandName(command)
 	}
 
-	if err = t.SetIps(args); err != nil {
+	if err != nil {
 		err = conf.NewErrCommand(command, err.Error())
 	}
 
@@ -110,13 +357,31 @@ func (t *OutgoingIp) Call(command conf.Command) (err error) {
 }
 
 func (t *OutgoingIp) CallBlock(command conf.Command) (conf.Block, error) {
-	if command.GetName() != ModuleDirective {
-		return nil, conf.NewErrCommandName(command)
-	}
+	switch command.GetName() {
+	case ModuleDirective:
+		if len(command.GetArgs()) != 0 {
+			return nil, conf.NewErrCommandArgsNumber(command)
+		}
+
+		// the block replaces ips of the parent context
+		t.Pool = NewPool("")
+
+		return NewConfBlock(t.Pool), nil
+	case ModuleDirectivePool:
+		if len(command.GetArgs()) != 1 {
+			return nil, conf.NewErrCommandArgsNumber(command)
+		}
+		if t.InCondition {
+			return nil, conf.NewErrCommand(command, "ip pool can be defined only in main context")
+		}
+
+		pool := NewPool(command.GetArgs()[0])
+		if err := DefaultPools.Add(pool); err != nil {
+			return nil, conf.NewErrCommand(command, err.Error())
+		}
 
-	if len(command.GetArgs()) != 0 {
-		return nil, conf.NewErrCommandArgsNumber(command)
+		return NewConfBlock(pool), nil
 	}
 
-	return NewConfBlock(t), nil
+	return nil, conf.NewErrCommandName(command)
 }
@@ -0,0 +1,254 @@
+package outgoingip
+
+import (
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const PoolPrefix = "pool:"
+
+// DefaultPools are named pools defined by "ip_pool" directive
+var DefaultPools = NewPools()
+
+// Pool is a set of outgoing ips, named pools are shared by all contexts and can be loaded from the file (reloaded on change)
+type Pool struct {
+	Name    string
+	IpsV4   []*Ip
+	IpsV6   []*Ip
+	RWMutex *sync.RWMutex
+	Watcher *utils.FileWatcher
+}
+
+func NewPool(name string) *Pool {
+	return &Pool{
+		Name:    name,
+		IpsV4:   make([]*Ip, 0),
+		IpsV6:   make([]*Ip, 0),
+		RWMutex: new(sync.RWMutex),
+	}
+}
+
+// Get returns ipv4 and ipv6 ips, the slices must not be modified
+func (t *Pool) Get() ([]*Ip, []*Ip) {
+	t.RWMutex.RLock()
+	defer t.RWMutex.RUnlock()
+
+	return t.IpsV4, t.IpsV6
+}
+
+// AddIps adds ips from arguments, argument "weight=N" sets weight of the previous ip
+func (t *Pool) AddIps(args []string) error {
+	for i := 0; i < len(args); i++ {
+		ip := args[i]
+		weight := 1
+
+		if i+1 < len(args) && strings.HasPrefix(args[i+1], weightPrefix) {
+			i++
+
+			var err error
+			if weight, err = strconv.Atoi(args[i][len(weightPrefix):]); err != nil || weight < 1 {
+				return fmt.Errorf("wrong weight - '%s'", args[i])
+			}
+		}
+
+		if err := t.AddIp(ip, weight); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddIp adds ip, CIDR or range of ips
+func (t *Pool) AddIp(ipStr string, weight int) error {
+	ip, err := ParseIp(ipStr, weight)
+	if err != nil {
+		return err
+	}
+	if ip.IsRange() && !prifma.FreeBindSupported {
+		return fmt.Errorf("outgoing ip ranges are supported only on linux - '%s'", ipStr)
+	}
+
+	t.RWMutex.Lock()
+	defer t.RWMutex.Unlock()
+
+	// slices returned by Get are not changed
+	if len(ip.Ip) == net.IPv4len {
+		t.IpsV4 = append(t.IpsV4[:len(t.IpsV4):len(t.IpsV4)], ip)
+	} else {
+		t.IpsV6 = append(t.IpsV6[:len(t.IpsV6):len(t.IpsV6)], ip)
+	}
+
+	return nil
+}
+
+// LoadFile loads ips from the file and reloads them on change
+func (t *Pool) LoadFile(filename string) error {
+	watcher, err := utils.WatchFile(filename, t.Load)
+	if err != nil {
+		return fmt.Errorf("can't load ip pool file: '%s' (%v)", filename, err)
+	}
+
+	t.Watcher = watcher
+
+	return nil
+}
+
+// Load loads ips from the file, line format: "ip [weight=N]", "cidr [weight=N]" or "ip-ip [weight=N]"
+func (t *Pool) Load(filename string) error {
+	lines, err := utils.ReadFileLines(filename)
+	if err != nil {
+		return err
+	}
+
+	pool := NewPool(t.Name)
+	for _, line := range lines {
+		if err = pool.AddIps(strings.Fields(line)); err != nil {
+			return fmt.Errorf("%v in ip pool file: '%s'", err, filename)
+		}
+	}
+
+	t.RWMutex.Lock()
+	t.IpsV4, t.IpsV6 = pool.IpsV4, pool.IpsV6
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+func (t *Pool) PopError() error {
+	if t.Watcher == nil {
+		return nil
+	}
+
+	return t.Watcher.PopError()
+}
+
+// Contains returns true if the ip is one of ips (or in one of ranges)
+func (t *Pool) Contains(ip net.IP) bool {
+	return t.GetIp(ip) != nil
+}
+
+// GetIp returns the item of ips containing the ip, nil if not found
+func (t *Pool) GetIp(ip net.IP) *Ip {
+	ipsV4, ipsV6 := t.Get()
+
+	for _, ips := range [2][]*Ip{ipsV4, ipsV6} {
+		for _, item := range ips {
+			if item.Contains(ip) {
+				return item
+			}
+		}
+	}
+
+	return nil
+}
+
+// ContainsAddress returns true if the ip is one of ips (not in ranges)
+func (t *Pool) ContainsAddress(ip net.IP) bool {
+	ipsV4, ipsV6 := t.Get()
+
+	for _, ips := range [2][]*Ip{ipsV4, ipsV6} {
+		for _, item := range ips {
+			if !item.IsRange() && item.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ApplyPool sets outgoing ips of the pool requested by headers,
+// ips are selected like by "outgoing_ip" of the request (strategy, health and sessions)
+func ApplyPool(result prifma.HandleRequestResult, pool *Pool) error {
+	if selection, ok := result.GetOutgoingIps().(*Selection); ok {
+		return selection.OutgoingIp.Apply(result, pool)
+	}
+
+	return New().Apply(result, pool)
+}
+
+// Selection is the pool of the request and the module selecting its ips
+type Selection struct {
+	OutgoingIp *OutgoingIp
+	Pool       *Pool
+	SessionKey string
+	Fixed      bool // ips are requested by headers
+}
+
+func NewSelection(outgoingIp *OutgoingIp, pool *Pool, sessionKey string) *Selection {
+	return &Selection{
+		OutgoingIp: outgoingIp,
+		Pool:       pool,
+		SessionKey: sessionKey,
+	}
+}
+
+// FixIps marks outgoing ips of the request as requested by headers, so they aren't switched (see "limit_outgoing")
+func FixIps(result prifma.HandleRequestResult) {
+	if selection, ok := result.GetOutgoingIps().(*Selection); ok {
+		selection.Fixed = true
+	}
+}
+
+func (t *Selection) Contains(ip net.IP) bool {
+	return t.Pool.Contains(ip)
+}
+
+// GetHealthKey returns the key of failures of ips of the pool containing the ip (see "outgoing_ip_health")
+func (t *Selection) GetHealthKey(ip net.IP, domain string) (string, bool) {
+	if t.OutgoingIp.HealthThreshold == 0 {
+		return "", false
+	}
+
+	item := t.Pool.GetIp(ip)
+	if item == nil {
+		return "", false
+	}
+
+	return t.OutgoingIp.GetHealthKey(item, domain), true
+}
+
+// Pools are filled on config loading
+type Pools struct {
+	Pools map[string]*Pool
+}
+
+func NewPools() *Pools {
+	return &Pools{
+		Pools: make(map[string]*Pool),
+	}
+}
+
+func (t *Pools) Add(pool *Pool) error {
+	if _, ok := t.Pools[pool.Name]; ok {
+		return fmt.Errorf("ip pool is already defined - '%s'", pool.Name)
+	}
+
+	t.Pools[pool.Name] = pool
+
+	return nil
+}
+
+func (t *Pools) Get(name string) (*Pool, error) {
+	pool, ok := t.Pools[name]
+	if !ok {
+		return nil, fmt.Errorf("ip pool is not defined - '%s'", name)
+	}
+
+	return pool, nil
+}
+
+// GetByValue returns the pool by value "pool:name", nil if the value is not a pool
+func (t *Pools) GetByValue(val string) (*Pool, error) {
+	if !strings.HasPrefix(val, PoolPrefix) {
+		return nil, nil
+	}
+
+	return t.Get(val[len(PoolPrefix):])
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package outgoingip
+
+import (
+	"testing"
+)
+
+func TestPoolAddIpRange(t *testing.T) {
+	pool := NewPool("test")
+
+	for _, ip := range []string{"10.0.0.0/24", "10.0.0.10-10.0.0.20", "2001:db8::/64"} {
+		if err := pool.AddIp(ip, 1); err == nil {
+			t.Errorf("range '%s' is added without free bind", ip)
+		}
+	}
+
+	// single ips and CIDR of one ip are not ranges
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2/32", "2001:db8::1/128"} {
+		if err := pool.AddIp(ip, 1); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if ipsV4, ipsV6 := pool.Get(); len(ipsV4) != 2 || len(ipsV6) != 1 {
+		t.Errorf("pool has %d ipv4 and %d ipv6 ips, want 2 and 1", len(ipsV4), len(ipsV6))
+	}
+}
@@ -0,0 +1,69 @@
+package outgoingip
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type Session struct {
+	Ip      *Ip
+	Address net.IP
+	Expires time.Time
+}
+
+// Sessions binds session keys (user and "Proxy-Session-Id") to outgoing ips
+type Sessions struct {
+	Items     map[string]*Session
+	LastSweep time.Time
+	Mutex     *sync.Mutex
+}
+
+func NewSessions() *Sessions {
+	return &Sessions{
+		Items:     make(map[string]*Session),
+		LastSweep: time.Now(),
+		Mutex:     new(sync.Mutex),
+	}
+}
+
+// Get returns the bound ip and address if the ip is still in ips, otherwise binds the ip returned by selectIp for the ttl
+func (t *Sessions) Get(key string, ips []*Ip, ttl time.Duration, selectIp func() (*Ip, net.IP)) (*Ip, net.IP) {
+	now := time.Now()
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.sweep(now, ttl)
+
+	if session, ok := t.Items[key]; ok && now.Before(session.Expires) {
+		for _, ip := range ips {
+			if ip.Equal(session.Ip) {
+				return ip, session.Address
+			}
+		}
+	}
+
+	ip, address := selectIp()
+	t.Items[key] = &Session{
+		Ip:      ip,
+		Address: address,
+		Expires: now.Add(ttl),
+	}
+
+	return ip, address
+}
+
+func (t *Sessions) sweep(now time.Time, ttl time.Duration) {
+	if now.Sub(t.LastSweep) < ttl {
+		return
+	}
+
+	for key, session := range t.Items {
+		if now.After(session.Expires) {
+			delete(t.Items, key)
+		}
+	}
+
+	t.LastSweep = now
+}
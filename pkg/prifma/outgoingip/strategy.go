@@ -0,0 +1,181 @@
+package outgoingip
+
+import (
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+const (
+	StrategyNameRandom     = "random"
+	StrategyNameRoundRobin = "round_robin"
+	StrategyNameWeighted   = "weighted"
+	StrategyNameSticky     = "sticky"
+)
+
+const (
+	StickyKeyUser      = "user"
+	StickyKeySrcIp     = "src_ip"
+	StickyKeyDstDomain = "dst_domain"
+)
+
+// Strategy selects ip of the list (pool and address family), e.g. round robin has the counter of each list
+type Strategy interface {
+	Select(list string, ips []*Ip, req *http.Request) *Ip
+}
+
+// StrategyKey selects the same ip (and the same address of the range) for the same key
+type StrategyKey interface {
+	GetKey(req *http.Request) string
+}
+
+func NewStrategy(name string, args []string) (Strategy, error) {
+	if name == StrategyNameSticky {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("sticky strategy requires a key: %s, %s or %s", StickyKeyUser, StickyKeySrcIp, StickyKeyDstDomain)
+		}
+
+		return NewStrategySticky(args[0])
+	}
+
+	if len(args) != 0 {
+		return nil, fmt.Errorf("strategy '%s' has no arguments", name)
+	}
+
+	switch name {
+	case StrategyNameRandom:
+		return NewStrategyRandom(), nil
+	case StrategyNameRoundRobin:
+		return NewStrategyRoundRobin(), nil
+	case StrategyNameWeighted:
+		return NewStrategyWeighted(), nil
+	}
+
+	return nil, fmt.Errorf("wrong strategy - '%s'", name)
+}
+
+type StrategyRandom struct{}
+
+func NewStrategyRandom() *StrategyRandom {
+	return &StrategyRandom{}
+}
+
+func (t *StrategyRandom) Select(_ string, ips []*Ip, req *http.Request) *Ip {
+	return ips[rand.Intn(len(ips))]
+}
+
+type StrategyRoundRobin struct {
+	Counters map[string]uint64
+	Mutex    *sync.Mutex
+}
+
+func NewStrategyRoundRobin() *StrategyRoundRobin {
+	return &StrategyRoundRobin{
+		Counters: make(map[string]uint64),
+		Mutex:    new(sync.Mutex),
+	}
+}
+
+func (t *StrategyRoundRobin) Select(list string, ips []*Ip, req *http.Request) *Ip {
+	t.Mutex.Lock()
+	counter := t.Counters[list]
+	t.Counters[list] = counter + 1
+	t.Mutex.Unlock()
+
+	return ips[counter%uint64(len(ips))]
+}
+
+type StrategyWeighted struct{}
+
+func NewStrategyWeighted() *StrategyWeighted {
+	return &StrategyWeighted{}
+}
+
+func (t *StrategyWeighted) Select(_ string, ips []*Ip, req *http.Request) *Ip {
+	total := 0
+	for _, ip := range ips {
+		total += ip.Weight
+	}
+
+	n := rand.Intn(total)
+	for _, ip := range ips {
+		if n -= ip.Weight; n < 0 {
+			return ip
+		}
+	}
+
+	return ips[len(ips)-1]
+}
+
+// StrategySticky selects ip by weighted rendezvous hashing of the request key,
+// so adding or removing an ip remaps only keys of this ip
+type StrategySticky struct {
+	Key string
+}
+
+func NewStrategySticky(key string) (*StrategySticky, error) {
+	switch key {
+	case StickyKeyUser, StickyKeySrcIp, StickyKeyDstDomain:
+	default:
+		return nil, fmt.Errorf("wrong sticky key - '%s'", key)
+	}
+
+	return &StrategySticky{
+		Key: key,
+	}, nil
+}
+
+func (t *StrategySticky) Select(_ string, ips []*Ip, req *http.Request) *Ip {
+	key := t.GetKey(req)
+
+	var selected *Ip
+	maxScore := math.Inf(-1)
+
+	for _, ip := range ips {
+		if score := RendezvousScore(key, ip); score > maxScore {
+			selected = ip
+			maxScore = score
+		}
+	}
+
+	return selected
+}
+
+func (t *StrategySticky) GetKey(req *http.Request) string {
+	switch t.Key {
+	case StickyKeyUser:
+		if user, _, ok := utils.ProxyBasicAuth(req); ok {
+			return user
+		}
+
+		return utils.GetHostname(req.RemoteAddr)
+	case StickyKeySrcIp:
+		return utils.GetHostname(req.RemoteAddr)
+	default:
+		return utils.GetHostname(req.Host)
+	}
+}
+
+func RendezvousScore(key string, ip *Ip) float64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write(ip.Ip)
+
+	// fnv changes only low bits on the last bytes, so the bits are mixed for ips of the same network
+	sum := hash.Sum64()
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+	sum *= 0xc4ceb9fe1a85ec53
+	sum ^= sum >> 33
+
+	// uniform value in (0, 1)
+	h := (float64(sum>>11) + 1) / (1<<53 + 1)
+
+	return -float64(ip.Weight) / math.Log(h)
+}
@@ -20,6 +20,8 @@ func NewRequestHandler(server Server) *RequestHandler {
 }
 
 func (t *RequestHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	req = req.WithContext(WithJwtClaims(req.Context()))
+
 	modules := t.Server.GetModulesManager().GetModulesForRequest(req)
 
 	for _, module := range modules {
@@ -30,6 +32,40 @@ func (t *RequestHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	result := t.HandleRequest(req, modules)
+
+	if response, ok := result.GetResponse().(RehandleResponse); ok {
+		t.WriteResponseHeader(rw, result)
+
+		rehandledRw, rehandledReq, err := response.Rehandle(rw, result)
+		if err != nil {
+			t.Server.GetErrorLog().Println(err)
+		}
+		if rehandledRw != nil {
+			rw = rehandledRw
+		}
+		if rehandledReq != nil && rehandledReq != req {
+			req = rehandledReq
+			modules, result = t.RehandleRequest(req, modules, result)
+		}
+	}
+
+	t.WriteResponseHeader(rw, result)
+
+	if err := result.GetResponse().Write(rw, result); err != nil {
+		t.Server.GetErrorLog().Println(err)
+	}
+
+	for _, module := range modules {
+		if handler, ok := module.(AfterWriteResponseModule); ok {
+			if err := handler.AfterWriteResponse(req, result.GetResponse()); err != nil {
+				t.Server.GetErrorLog().Println(err)
+			}
+		}
+	}
+}
+
+func (t *RequestHandler) HandleRequest(req *http.Request, modules []Module) HandleRequestResult {
 	var result HandleRequestResult = NewHandleRequestResult(req, t.Server)
 
 	for _, module := range modules {
@@ -50,15 +86,40 @@ func (t *RequestHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	if result.GetResponse() == nil {
 		result.SetResponse(NewResponseError(http.StatusInternalServerError, ""))
 	}
-	if err := result.GetResponse().Write(rw, result); err != nil {
-		t.Server.GetErrorLog().Println(err)
+
+	return result
+}
+
+// RehandleRequest handles the request changed by the rehandled response (e.g. the server name read by "ssl_preread").
+// Modules are called again only if conditions select other modules, so modules don't repeat their work (auth, limits)
+func (t *RequestHandler) RehandleRequest(req *http.Request, modules []Module, result HandleRequestResult) ([]Module, HandleRequestResult) {
+	rehandledModules := t.Server.GetModulesManager().GetModulesForRequest(req)
+
+	if isSameModules(modules, rehandledModules) {
+		result.SetRequest(req)
+
+		return modules, result
 	}
 
-	for _, module := range modules {
-		if handler, ok := module.(AfterWriteResponseModule); ok {
-			if err := handler.AfterWriteResponse(req, result.GetResponse()); err != nil {
-				t.Server.GetErrorLog().Println(err)
-			}
+	return rehandledModules, t.HandleRequest(req, rehandledModules)
+}
+
+func isSameModules(modules1 []Module, modules2 []Module) bool {
+	if len(modules1) != len(modules2) {
+		return false
+	}
+
+	for i := range modules1 {
+		if modules1[i] != modules2[i] {
+			return false
 		}
 	}
+
+	return true
+}
+
+func (t *RequestHandler) WriteResponseHeader(rw http.ResponseWriter, result HandleRequestResult) {
+	for key, values := range result.GetResponseHeader() {
+		rw.Header()[key] = values
+	}
 }
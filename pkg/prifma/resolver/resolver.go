@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/conf"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"strings"
+	"time"
+)
+
+const ModuleDirective = "resolver"
+
+const timeoutPrefix = "timeout="
+
+// Resolver sets DNS servers used by the dialer, each directive has its own DNS cache
+type Resolver struct {
+	DNS prifma.DNS // prifma.DefaultDNS if nil
+}
+
+func New() *Resolver {
+	return new(Resolver)
+}
+
+func (t *Resolver) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
+	t.SetupDialer(result.GetDialer())
+
+	return result, nil
+}
+
+func (t *Resolver) SetupDialer(dialer prifma.Dialer) {
+	dialer.SetDNS(t.DNS)
+}
+
+func (t *Resolver) Off() error {
+	t.DNS = nil
+
+	return nil
+}
+
+// SetServers sets DNS servers, args: address... [tcp] [timeout=time]
+func (t *Resolver) SetServers(args []string) error {
+	servers := NewServers()
+	addrs := make([]string, 0, len(args))
+	tcp := false
+
+	for _, arg := range args {
+		switch true {
+		case arg == "tcp":
+			tcp = true
+		case strings.HasPrefix(arg, timeoutPrefix):
+			timeout, err := time.ParseDuration(arg[len(timeoutPrefix):])
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("wrong timeout - '%s'", arg)
+			}
+
+			servers.Timeout = timeout
+		default:
+			addrs = append(addrs, arg)
+		}
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("servers are not defined")
+	}
+
+	for _, addr := range addrs {
+		server, err := NewServer(addr, tcp)
+		if err != nil {
+			return err
+		}
+
+		servers.Add(server)
+	}
+
+	t.DNS = prifma.NewDNS(servers.Dial)
+
+	return nil
+}
+
+func (t *Resolver) GetDirective() string {
+	return ModuleDirective
+}
+
+func (t *Resolver) Clone() prifma.Module {
+	clone := *t
+
+	return &clone
+}
+
+func (t *Resolver) Call(command conf.Command) (err error) {
+	if command.GetName() != ModuleDirective {
+		return conf.NewErrCommandName(command)
+	}
+
+	args := command.GetArgs()
+	if len(args) == 0 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	if len(args) == 1 && args[0] == "off" {
+		return t.Off()
+	}
+
+	if err = t.SetServers(args); err != nil {
+		err = conf.NewErrCommand(command, err.Error())
+	}
+
+	return err
+}
+
+func (t *Resolver) CallBlock(command conf.Command) (conf.Block, error) {
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
+}
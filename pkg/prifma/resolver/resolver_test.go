@@ -0,0 +1,219 @@
+package resolver
+
+import (
+	"context"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testDNSServer answers A records of Hosts, other names are not found, all names fail while Fail is set
+type testDNSServer struct {
+	Conn    net.PacketConn
+	Hosts   map[string]net.IP
+	Fail    bool
+	Queries map[string]int
+	Mutex   *sync.Mutex
+}
+
+func newTestDNSServer(t *testing.T, hosts map[string]net.IP) *testDNSServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &testDNSServer{
+		Conn:    conn,
+		Hosts:   hosts,
+		Queries: make(map[string]int),
+		Mutex:   new(sync.Mutex),
+	}
+
+	go server.serve()
+
+	return server
+}
+
+func (t *testDNSServer) serve() {
+	b := make([]byte, 512)
+
+	for {
+		n, addr, err := t.Conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err = msg.Unpack(b[:n]); err != nil || len(msg.Questions) == 0 {
+			continue
+		}
+
+		question := msg.Questions[0]
+		name := question.Name.String()
+
+		t.Mutex.Lock()
+		t.Queries[name]++
+		fail := t.Fail
+		t.Mutex.Unlock()
+
+		msg.Header.Response = true
+		ip, ok := t.Hosts[name]
+
+		switch true {
+		case fail:
+			msg.Header.RCode = dnsmessage.RCodeServerFailure
+		case !ok:
+			msg.Header.RCode = dnsmessage.RCodeNameError
+		case question.Type == dnsmessage.TypeA:
+			var a dnsmessage.AResource
+			copy(a.A[:], ip.To4())
+
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{
+					Name:  question.Name,
+					Type:  dnsmessage.TypeA,
+					Class: dnsmessage.ClassINET,
+					TTL:   300,
+				},
+				Body: &a,
+			}}
+		}
+
+		answer, err := msg.Pack()
+		if err != nil {
+			continue
+		}
+
+		_, _ = t.Conn.WriteTo(answer, addr)
+	}
+}
+
+func (t *testDNSServer) SetFail(fail bool) {
+	t.Mutex.Lock()
+	t.Fail = fail
+	t.Mutex.Unlock()
+}
+
+func (t *testDNSServer) GetQueries(name string) int {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	return t.Queries[name]
+}
+
+type testGeoIp struct {
+	Countries map[string]string
+}
+
+func (t *testGeoIp) AddDb(string) error {
+	return nil
+}
+
+func (t *testGeoIp) HasDb() bool {
+	return true
+}
+
+func (t *testGeoIp) Lookup(ip net.IP) (*prifma.GeoIpRecord, error) {
+	record := new(prifma.GeoIpRecord)
+	record.Country.IsoCode = t.Countries[ip.String()]
+
+	return record, nil
+}
+
+func newTestResolver(t *testing.T, server *testDNSServer) *Resolver {
+	t.Helper()
+
+	resolver := New()
+	if err := resolver.SetServers([]string{server.Conn.LocalAddr().String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	return resolver
+}
+
+func TestResolverDstCountry(t *testing.T) {
+	server := newTestDNSServer(t, map[string]net.IP{
+		"ru.example.": net.ParseIP("192.0.2.1"),
+		"de.example.": net.ParseIP("192.0.2.2"),
+	})
+	defer server.Conn.Close()
+
+	tester, err := prifma.NewConditionTesterEquals("RU")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// destinations are resolved before "outgoing_ip" of the request, so DNS servers are connected by the system dialer
+	cond := prifma.NewConditionDstCountry(tester, &testGeoIp{Countries: map[string]string{
+		"192.0.2.1": "RU",
+		"192.0.2.2": "DE",
+	}})
+	cond.SetDialerModules([]prifma.Module{newTestResolver(t, server)})
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "ru.example", want: true},
+		{host: "ru.example:8080", want: true},
+		{host: "de.example", want: false},
+		{host: "missing.example", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://"+test.host+"/", nil)
+
+			if got := cond.Test(req); got != test.want {
+				t.Errorf("Test = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if queries := server.GetQueries("ru.example."); queries == 0 {
+		t.Errorf("the resolver isn't used")
+	}
+}
+
+func TestResolverErrorsCache(t *testing.T) {
+	server := newTestDNSServer(t, map[string]net.IP{
+		"example.": net.ParseIP("192.0.2.1"),
+	})
+	defer server.Conn.Close()
+
+	dns := newTestResolver(t, server).DNS
+	ctx := context.Background()
+
+	// the host without ips is cached
+	if _, err := dns.LookupIp(ctx, "missing.example"); !prifma.IsDNSNotFound(err) {
+		t.Fatalf("error = %v, want not found", err)
+	}
+
+	queries := server.GetQueries("missing.example.")
+	if _, err := dns.LookupIp(ctx, "missing.example"); !prifma.IsDNSNotFound(err) {
+		t.Fatalf("cached error = %v, want not found", err)
+	}
+	if server.GetQueries("missing.example.") != queries {
+		t.Errorf("the host without ips isn't cached")
+	}
+
+	// failures of servers aren't cached
+	server.SetFail(true)
+	if _, err := dns.LookupIp(ctx, "example"); err == nil || prifma.IsDNSNotFound(err) {
+		t.Fatalf("error = %v, want server failure", err)
+	}
+
+	server.SetFail(false)
+	ips, err := dns.LookupIp(ctx, "example")
+	if err != nil {
+		t.Fatalf("the failure is cached: %v", err)
+	}
+	if ip := ips.GetIpV4(); !ip.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("ip = %s, want 192.0.2.1", ip)
+	}
+}
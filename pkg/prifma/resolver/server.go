@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultPort    = "53"
+	DefaultTlsPort = "853"
+
+	SchemeTls   = "tls"
+	SchemeHttps = "https"
+)
+
+// NewServer creates the server by the address: ip[:port], tls://host[:port] (DNS-over-TLS) or https://host/path (DNS-over-HTTPS)
+func NewServer(addr string, tcp bool) (Server, error) {
+	if !strings.Contains(addr, "://") {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+			port = DefaultPort
+		}
+
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("wrong server address - '%s'", addr)
+		}
+
+		return &PlainServer{
+			Addr: net.JoinHostPort(host, port),
+			Tcp:  tcp,
+		}, nil
+	}
+
+	uri, err := url.Parse(addr)
+	if err != nil || uri.Hostname() == "" {
+		return nil, fmt.Errorf("wrong server address - '%s'", addr)
+	}
+
+	switch uri.Scheme {
+	case SchemeTls:
+		port := uri.Port()
+		if port == "" {
+			port = DefaultTlsPort
+		}
+
+		return &TlsServer{
+			Addr:       net.JoinHostPort(uri.Hostname(), port),
+			ServerName: uri.Hostname(),
+		}, nil
+	case SchemeHttps:
+		return NewHttpsServer(uri), nil
+	}
+
+	return nil, fmt.Errorf("wrong server scheme - '%s'", addr)
+}
+
+// PlainServer is the DNS server over UDP (TCP if the answer is truncated) or TCP
+type PlainServer struct {
+	Addr string
+	Tcp  bool
+}
+
+func (t *PlainServer) Dial(ctx context.Context, network string) (net.Conn, error) {
+	if t.Tcp {
+		network = "tcp"
+	}
+
+	return DialContext(ctx, network, t.Addr)
+}
+
+// TlsServer is the DNS-over-TLS server (RFC 7858), messages are sent like over TCP
+type TlsServer struct {
+	Addr       string
+	ServerName string
+}
+
+func (t *TlsServer) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	conn, err := DialContext(ctx, "tcp", t.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: t.ServerName,
+	})
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = tlsConn.SetDeadline(deadline)
+	}
+
+	if err = tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// DialContext connects from the outgoing ip of the request which started the lookup
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dialer := prifma.GetDNSDialer(ctx); dialer != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	return new(net.Dialer).DialContext(ctx, network, addr)
+}
@@ -0,0 +1,242 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/prifma"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ContentTypeDNSMessage = "application/dns-message"
+	// MaxDNSMessageSize - max size of the DNS message with the length prefix
+	MaxDNSMessageSize = 65535
+	// TransportsIdleTimeout - transports which were not used longer are removed
+	TransportsIdleTimeout = 5 * time.Minute
+)
+
+var ErrConnClosed = errors.New("connection is closed")
+
+// HttpsServer is the DNS-over-HTTPS server (RFC 8484), messages are sent by POST requests.
+// Connections are kept alive for each outgoing ip.
+type HttpsServer struct {
+	Url        string
+	Transports map[prifma.DialerKey]*HttpsTransport
+	Mutex      *sync.Mutex
+	LastSweep  time.Time
+}
+
+type HttpsTransport struct {
+	LastUsed  int64 // unix nano, the first field for 64-bit alignment of atomic operations
+	Transport *http.Transport
+}
+
+func NewHttpsServer(uri *url.URL) *HttpsServer {
+	return &HttpsServer{
+		Url:        uri.String(),
+		Transports: make(map[prifma.DialerKey]*HttpsTransport),
+		Mutex:      new(sync.Mutex),
+		LastSweep:  time.Now(),
+	}
+}
+
+func (t *HttpsServer) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	return &HttpsConn{
+		Server:    t,
+		Transport: t.GetTransport(prifma.GetDNSDialer(ctx)),
+		Ctx:       ctx,
+	}, nil
+}
+
+// GetTransport returns the transport connecting from ips of the dialer,
+// transports are shared like round trippers of the "http" module (see prifma.DialerKey)
+func (t *HttpsServer) GetTransport(dialer prifma.Dialer) *http.Transport {
+	key := prifma.DialerKey{}
+	dialContext := new(net.Dialer).DialContext
+
+	if dialer != nil {
+		key = prifma.NewDialerKey(dialer)
+		dialContext = dialer.DialContext
+
+		// connections from the random ip of the range wouldn't be reused
+		if dialer.GetRandomIp() {
+			return &http.Transport{
+				DialContext:       dialContext,
+				ForceAttemptHTTP2: true,
+				DisableKeepAlives: true,
+			}
+		}
+	}
+
+	now := time.Now()
+
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.sweep(now)
+
+	item := t.Transports[key]
+	if item == nil {
+		item = &HttpsTransport{
+			Transport: &http.Transport{
+				DialContext:       dialContext,
+				ForceAttemptHTTP2: true,
+				IdleConnTimeout:   TransportsIdleTimeout,
+			},
+		}
+		t.Transports[key] = item
+	}
+
+	atomic.StoreInt64(&item.LastUsed, now.UnixNano())
+
+	return item.Transport
+}
+
+func (t *HttpsServer) sweep(now time.Time) {
+	if now.Sub(t.LastSweep) < TransportsIdleTimeout {
+		return
+	}
+
+	for key, item := range t.Transports {
+		if now.Sub(time.Unix(0, atomic.LoadInt64(&item.LastUsed))) < TransportsIdleTimeout {
+			continue
+		}
+
+		item.Transport.CloseIdleConnections()
+		delete(t.Transports, key)
+	}
+
+	t.LastSweep = now
+}
+
+// HttpsConn sends DNS messages written by the resolver (with the length prefix like over TCP) to the server
+// and returns answers on read
+type HttpsConn struct {
+	Server    *HttpsServer
+	Transport *http.Transport
+	Ctx       context.Context
+	Deadline  time.Time
+	Request   bytes.Buffer
+	Response  bytes.Buffer
+	Closed    bool
+}
+
+func (t *HttpsConn) Write(b []byte) (int, error) {
+	if t.Closed {
+		return 0, ErrConnClosed
+	}
+
+	t.Request.Write(b)
+
+	for t.Request.Len() >= 2 {
+		msg := t.Request.Bytes()
+		length := int(msg[0])<<8 | int(msg[1])
+		if len(msg) < length+2 {
+			break
+		}
+
+		answer, err := t.Exchange(msg[2 : length+2])
+		if err != nil {
+			return 0, err
+		}
+
+		t.Request.Next(length + 2)
+		t.Response.Write([]byte{byte(len(answer) >> 8), byte(len(answer))})
+		t.Response.Write(answer)
+	}
+
+	return len(b), nil
+}
+
+func (t *HttpsConn) Read(b []byte) (int, error) {
+	if t.Closed {
+		return 0, ErrConnClosed
+	}
+	if t.Response.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	return t.Response.Read(b)
+}
+
+// Exchange sends the DNS message to the server and returns the answer
+func (t *HttpsConn) Exchange(msg []byte) ([]byte, error) {
+	ctx := t.Ctx
+	if !t.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, t.Deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.Server.Url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", ContentTypeDNSMessage)
+	req.Header.Set("Accept", ContentTypeDNSMessage)
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS server responded with %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, ContentTypeDNSMessage) {
+		return nil, fmt.Errorf("DNS-over-HTTPS server responded with wrong content type - '%s'", contentType)
+	}
+
+	answer, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxDNSMessageSize-2+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(answer) > MaxDNSMessageSize-2 {
+		return nil, errors.New("DNS-over-HTTPS answer is too large")
+	}
+
+	return answer, nil
+}
+
+func (t *HttpsConn) Close() error {
+	t.Closed = true
+
+	return nil
+}
+
+func (t *HttpsConn) LocalAddr() net.Addr {
+	return nil
+}
+
+func (t *HttpsConn) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (t *HttpsConn) SetDeadline(deadline time.Time) error {
+	t.Deadline = deadline
+
+	return nil
+}
+
+func (t *HttpsConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (t *HttpsConn) SetWriteDeadline(deadline time.Time) error {
+	t.Deadline = deadline
+
+	return nil
+}
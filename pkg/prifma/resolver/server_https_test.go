@@ -0,0 +1,184 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// newTestHttpsServer returns the server answering by the request message with the "answer:" prefix
+func newTestHttpsServer(t *testing.T, status int) (*httptest.Server, *[][]byte) {
+	t.Helper()
+
+	mutex := new(sync.Mutex)
+	requests := make([][]byte, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		msg, _ := ioutil.ReadAll(req.Body)
+
+		mutex.Lock()
+		requests = append(requests, msg)
+		mutex.Unlock()
+
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != ContentTypeDNSMessage {
+			rw.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		rw.Header().Set("Content-Type", ContentTypeDNSMessage)
+		rw.WriteHeader(status)
+		_, _ = rw.Write(append([]byte("answer:"), msg...))
+	}))
+
+	return server, &requests
+}
+
+func newTestHttpsConn(t *testing.T, server *httptest.Server) *HttpsConn {
+	t.Helper()
+
+	uri, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &HttpsConn{
+		Server:    NewHttpsServer(uri),
+		Transport: &http.Transport{},
+		Ctx:       context.Background(),
+	}
+}
+
+func withLengthPrefix(msg string) []byte {
+	return append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+func TestHttpsConnWrite(t *testing.T) {
+	long := string(bytes.Repeat([]byte("x"), 300))
+
+	tests := []struct {
+		name     string
+		writes   [][]byte
+		requests []string
+	}{
+		{
+			name:     "message in one write",
+			writes:   [][]byte{withLengthPrefix("msg1")},
+			requests: []string{"msg1"},
+		},
+		{
+			name:     "length prefix and message in separate writes",
+			writes:   [][]byte{withLengthPrefix("msg1")[:2], []byte("msg1")},
+			requests: []string{"msg1"},
+		},
+		{
+			name:     "length prefix split",
+			writes:   [][]byte{withLengthPrefix("msg1")[:1], withLengthPrefix("msg1")[1:3], []byte("sg1")},
+			requests: []string{"msg1"},
+		},
+		{
+			name:     "long message (2 bytes length)",
+			writes:   [][]byte{withLengthPrefix(long)[:100], withLengthPrefix(long)[100:]},
+			requests: []string{long},
+		},
+		{
+			name:     "messages in one write",
+			writes:   [][]byte{append(withLengthPrefix("msg1"), withLengthPrefix("msg22")...)},
+			requests: []string{"msg1", "msg22"},
+		},
+		{
+			name:     "second message split",
+			writes:   [][]byte{append(withLengthPrefix("msg1"), withLengthPrefix("msg22")[:3]...), []byte("sg22")},
+			requests: []string{"msg1", "msg22"},
+		},
+		{
+			name:     "incomplete message",
+			writes:   [][]byte{withLengthPrefix("msg1")[:5]},
+			requests: []string{},
+		},
+		{
+			name:     "empty message",
+			writes:   [][]byte{withLengthPrefix("")},
+			requests: []string{""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newTestHttpsServer(t, http.StatusOK)
+			defer server.Close()
+
+			conn := newTestHttpsConn(t, server)
+
+			for _, b := range test.writes {
+				n, err := conn.Write(b)
+				if err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+				if n != len(b) {
+					t.Fatalf("Write() = %d, want %d", n, len(b))
+				}
+			}
+
+			if len(*requests) != len(test.requests) {
+				t.Fatalf("sent %d requests, want %d", len(*requests), len(test.requests))
+			}
+
+			wantResponse := make([]byte, 0)
+			for i, request := range test.requests {
+				if string((*requests)[i]) != request {
+					t.Errorf("request %d = %q, want %q", i, (*requests)[i], request)
+				}
+
+				wantResponse = append(wantResponse, withLengthPrefix("answer:"+request)...)
+			}
+
+			response, err := ioutil.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !bytes.Equal(response, wantResponse) {
+				t.Errorf("response = %q, want %q", response, wantResponse)
+			}
+		})
+	}
+}
+
+func TestHttpsConnWriteError(t *testing.T) {
+	server, _ := newTestHttpsServer(t, http.StatusInternalServerError)
+	defer server.Close()
+
+	conn := newTestHttpsConn(t, server)
+
+	if _, err := conn.Write(withLengthPrefix("msg1")); err == nil {
+		t.Fatal("Write() error = nil, want error of the server status")
+	}
+
+	if _, err := conn.Read(make([]byte, 10)); err != io.EOF {
+		t.Errorf("Read() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestHttpsConnClosed(t *testing.T) {
+	server, requests := newTestHttpsServer(t, http.StatusOK)
+	defer server.Close()
+
+	conn := newTestHttpsConn(t, server)
+	_ = conn.Close()
+
+	if _, err := conn.Write(withLengthPrefix("msg1")); err != ErrConnClosed {
+		t.Errorf("Write() error = %v, want %v", err, ErrConnClosed)
+	}
+	if _, err := conn.Read(make([]byte, 10)); err != ErrConnClosed {
+		t.Errorf("Read() error = %v, want %v", err, ErrConnClosed)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("sent %d requests, want 0", len(*requests))
+	}
+}
@@ -0,0 +1,150 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ServerFailTimeout - the server isn't used after the error during this time, while other servers are available
+const ServerFailTimeout = 30 * time.Second
+
+// Server connects to the DNS server, the resolver uses framing of DNS messages depending on net.PacketConn
+type Server interface {
+	Dial(ctx context.Context, network string) (net.Conn, error)
+}
+
+// Servers are DNS servers used in turn, unavailable servers are skipped
+type Servers struct {
+	Items       []Server
+	FailedUntil []int64       // unix nano
+	Timeout     time.Duration // timeout of the query, 0 - the timeout of the system resolver
+	Counter     *uint64
+}
+
+func NewServers() *Servers {
+	return &Servers{
+		Counter: new(uint64),
+	}
+}
+
+func (t *Servers) Add(server Server) {
+	t.Items = append(t.Items, server)
+	t.FailedUntil = append(t.FailedUntil, 0)
+}
+
+// Dial connects to the next available server instead of the server of the system resolver (address)
+func (t *Servers) Dial(ctx context.Context, network, _ string) (conn net.Conn, err error) {
+	next := atomic.AddUint64(t.Counter, 1)
+	now := time.Now().UnixNano()
+
+	// failed servers are tried after available ones
+	for _, failed := range []bool{false, true} {
+		for i := range t.Items {
+			index := int((next + uint64(i)) % uint64(len(t.Items)))
+			if failed != (atomic.LoadInt64(&t.FailedUntil[index]) > now) {
+				continue
+			}
+
+			if conn, err = t.Items[index].Dial(ctx, network); err == nil {
+				return NewServerConn(conn, t, index), nil
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			t.Fail(index)
+		}
+	}
+
+	return nil, err
+}
+
+func (t *Servers) Fail(index int) {
+	atomic.StoreInt64(&t.FailedUntil[index], time.Now().Add(ServerFailTimeout).UnixNano())
+}
+
+// ServerConn limits deadlines set by the resolver to the query timeout and marks the server failed on errors
+type ServerConn struct {
+	net.Conn
+	Servers  *Servers
+	Index    int
+	Deadline time.Time
+}
+
+// ServerPacketConn is ServerConn for packet connections (UDP)
+type ServerPacketConn struct {
+	ServerConn
+}
+
+func NewServerConn(conn net.Conn, servers *Servers, index int) net.Conn {
+	t := ServerConn{
+		Conn:    conn,
+		Servers: servers,
+		Index:   index,
+	}
+
+	if servers.Timeout != 0 {
+		t.Deadline = time.Now().Add(servers.Timeout)
+		_ = conn.SetDeadline(t.Deadline)
+	}
+
+	if _, ok := conn.(net.PacketConn); ok {
+		return &ServerPacketConn{
+			ServerConn: t,
+		}
+	}
+
+	return &t
+}
+
+func (t *ServerConn) Read(b []byte) (int, error) {
+	// e.g. the timeout or "connection refused" of UDP
+	n, err := t.Conn.Read(b)
+	if err != nil {
+		t.Servers.Fail(t.Index)
+	}
+
+	return n, err
+}
+
+func (t *ServerConn) Write(b []byte) (int, error) {
+	n, err := t.Conn.Write(b)
+	if err != nil {
+		t.Servers.Fail(t.Index)
+	}
+
+	return n, err
+}
+
+func (t *ServerConn) SetDeadline(deadline time.Time) error {
+	return t.Conn.SetDeadline(t.limit(deadline))
+}
+
+func (t *ServerConn) SetReadDeadline(deadline time.Time) error {
+	return t.Conn.SetReadDeadline(t.limit(deadline))
+}
+
+func (t *ServerConn) SetWriteDeadline(deadline time.Time) error {
+	return t.Conn.SetWriteDeadline(t.limit(deadline))
+}
+
+func (t *ServerConn) limit(deadline time.Time) time.Time {
+	if t.Deadline.IsZero() {
+		return deadline
+	}
+	if deadline.IsZero() || deadline.After(t.Deadline) {
+		return t.Deadline
+	}
+
+	return deadline
+}
+
+func (t *ServerPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return t.Conn.(net.PacketConn).ReadFrom(b)
+}
+
+func (t *ServerPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return t.Conn.(net.PacketConn).WriteTo(b, addr)
+}
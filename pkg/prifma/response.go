@@ -13,6 +13,13 @@ type Response interface {
 	GetRAddr() net.Addr
 }
 
+// RehandleResponse can find out more about the request before writing (e.g. read the beginning of the tunnel).
+// If the returned request differs, modules are selected and handle the request again.
+// The returned http.ResponseWriter (if not nil) replaces the original one.
+type RehandleResponse interface {
+	Rehandle(rw http.ResponseWriter, result HandleRequestResult) (http.ResponseWriter, *http.Request, error)
+}
+
 type ResponseError struct {
 	Code  int
 	Error string
@@ -0,0 +1,312 @@
+package prifma
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var scheduleWeekdays = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+var scheduleMonths = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+type Schedule interface {
+	Contains(now time.Time) bool
+}
+
+type ScheduleTimeRange struct {
+	From int // minutes since midnight
+	To   int
+}
+
+// ScheduleWindows is a set of time windows (e.g. "mon-fri 22:00-06:00 Europe/Moscow").
+// If a window passes midnight, it belongs to the weekday it starts.
+type ScheduleWindows struct {
+	Weekdays [7]bool
+	Ranges   []ScheduleTimeRange
+	Location *time.Location
+}
+
+func NewScheduleWindows(val string) (*ScheduleWindows, error) {
+	t := &ScheduleWindows{
+		Ranges:   make([]ScheduleTimeRange, 0),
+		Location: time.Local,
+	}
+
+	hasWeekdays := false
+
+	for _, field := range strings.Fields(val) {
+		switch true {
+		case field[0] >= '0' && field[0] <= '9':
+			for _, rangeStr := range strings.Split(field, ",") {
+				timeRange, err := parseScheduleTimeRange(rangeStr)
+				if err != nil {
+					return nil, err
+				}
+
+				t.Ranges = append(t.Ranges, timeRange)
+			}
+		case isScheduleWeekdays(field):
+			for _, rangeStr := range strings.Split(field, ",") {
+				from, to, err := parseScheduleRange(rangeStr, scheduleWeekdays)
+				if err != nil {
+					return nil, err
+				}
+
+				for day := from; day != to; day = (day + 1) % 7 {
+					t.Weekdays[day] = true
+				}
+
+				t.Weekdays[to] = true
+			}
+
+			hasWeekdays = true
+		default:
+			location, err := time.LoadLocation(field)
+			if err != nil {
+				return nil, fmt.Errorf("wrong timezone - '%s'", field)
+			}
+
+			t.Location = location
+		}
+	}
+
+	if !hasWeekdays {
+		t.Weekdays = [7]bool{true, true, true, true, true, true, true}
+	}
+	if len(t.Ranges) == 0 {
+		t.Ranges = append(t.Ranges, ScheduleTimeRange{From: 0, To: 24 * 60})
+	}
+
+	return t, nil
+}
+
+func (t *ScheduleWindows) Contains(now time.Time) bool {
+	now = now.In(t.Location)
+	minute := now.Hour()*60 + now.Minute()
+	weekday := int(now.Weekday())
+	yesterday := (weekday + 6) % 7
+
+	for _, timeRange := range t.Ranges {
+		if timeRange.From < timeRange.To {
+			if t.Weekdays[weekday] && minute >= timeRange.From && minute < timeRange.To {
+				return true
+			}
+		} else {
+			if t.Weekdays[weekday] && minute >= timeRange.From {
+				return true
+			}
+			if t.Weekdays[yesterday] && minute < timeRange.To {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ScheduleCron matches minutes of cron expression: "minute hour day month weekday",
+// timezone can be set by prefix "TZ=Europe/Moscow"
+type ScheduleCron struct {
+	Minutes  [60]bool
+	Hours    [24]bool
+	Days     [32]bool
+	Months   [13]bool
+	Weekdays [7]bool
+	AnyDay   bool
+	AnyWeek  bool
+	Location *time.Location
+}
+
+func NewScheduleCron(val string) (*ScheduleCron, error) {
+	t := &ScheduleCron{
+		Location: time.Local,
+	}
+
+	fields := strings.Fields(val)
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "TZ=") || strings.HasPrefix(fields[0], "CRON_TZ=")) {
+		name := fields[0][strings.IndexByte(fields[0], '=')+1:]
+
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("wrong timezone - '%s'", name)
+		}
+
+		t.Location = location
+		fields = fields[1:]
+	}
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("wrong cron expression - '%s'", val)
+	}
+
+	var weekdays [8]bool
+	var err error
+
+	if err = parseScheduleCronField(fields[0], 0, 59, nil, t.Minutes[:]); err != nil {
+		return nil, err
+	}
+	if err = parseScheduleCronField(fields[1], 0, 23, nil, t.Hours[:]); err != nil {
+		return nil, err
+	}
+	if err = parseScheduleCronField(fields[2], 1, 31, nil, t.Days[:]); err != nil {
+		return nil, err
+	}
+	if err = parseScheduleCronField(fields[3], 1, 12, scheduleMonths, t.Months[:]); err != nil {
+		return nil, err
+	}
+	if err = parseScheduleCronField(fields[4], 0, 7, scheduleWeekdays, weekdays[:]); err != nil {
+		return nil, err
+	}
+
+	copy(t.Weekdays[:], weekdays[:7])
+	t.Weekdays[0] = t.Weekdays[0] || weekdays[7]
+	t.AnyDay = fields[2] == "*"
+	t.AnyWeek = fields[4] == "*"
+
+	return t, nil
+}
+
+func (t *ScheduleCron) Contains(now time.Time) bool {
+	now = now.In(t.Location)
+
+	if !t.Minutes[now.Minute()] || !t.Hours[now.Hour()] || !t.Months[now.Month()] {
+		return false
+	}
+
+	day := t.Days[now.Day()]
+	weekday := t.Weekdays[now.Weekday()]
+
+	switch true {
+	case t.AnyDay && t.AnyWeek:
+		return true
+	case t.AnyDay:
+		return weekday
+	case t.AnyWeek:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+func parseScheduleCronField(field string, min int, max int, names map[string]int, values []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return fmt.Errorf("wrong cron field - '%s'", field)
+			}
+
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			var err error
+			if from, to, err = parseScheduleRange(part, names); err != nil {
+				return err
+			}
+			if from < min || to > max || from > to {
+				return fmt.Errorf("wrong cron field - '%s'", field)
+			}
+			if step > 1 && !strings.ContainsRune(part, '-') {
+				to = max
+			}
+		}
+
+		for i := from; i <= to; i += step {
+			values[i] = true
+		}
+	}
+
+	return nil
+}
+
+func parseScheduleRange(val string, names map[string]int) (from int, to int, err error) {
+	fromStr, toStr := val, val
+	if i := strings.IndexByte(val, '-'); i >= 0 {
+		fromStr, toStr = val[:i], val[i+1:]
+	}
+
+	if from, err = parseScheduleValue(fromStr, names); err != nil {
+		return 0, 0, err
+	}
+	if to, err = parseScheduleValue(toStr, names); err != nil {
+		return 0, 0, err
+	}
+
+	return from, to, nil
+}
+
+func parseScheduleValue(val string, names map[string]int) (int, error) {
+	if value, ok := names[strings.ToLower(val)]; ok {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("wrong schedule value - '%s'", val)
+	}
+
+	return value, nil
+}
+
+func parseScheduleTimeRange(val string) (ScheduleTimeRange, error) {
+	i := strings.IndexByte(val, '-')
+	if i < 0 {
+		return ScheduleTimeRange{}, fmt.Errorf("wrong time range - '%s'", val)
+	}
+
+	from, err := parseScheduleTime(val[:i])
+	if err != nil {
+		return ScheduleTimeRange{}, err
+	}
+
+	to, err := parseScheduleTime(val[i+1:])
+	if err != nil {
+		return ScheduleTimeRange{}, err
+	}
+
+	// equal start and end (e.g. "00:00-00:00") is the whole day from the start
+	if from == to {
+		from %= 24 * 60
+		to = from
+	}
+
+	return ScheduleTimeRange{From: from, To: to}, nil
+}
+
+func parseScheduleTime(val string) (int, error) {
+	i := strings.IndexByte(val, ':')
+	if i < 0 {
+		return 0, fmt.Errorf("wrong time - '%s'", val)
+	}
+
+	hour, errHour := strconv.Atoi(val[:i])
+	minute, errMinute := strconv.Atoi(val[i+1:])
+	if errHour != nil || errMinute != nil || hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("wrong time - '%s'", val)
+	}
+
+	return hour*60 + minute, nil
+}
+
+func isScheduleWeekdays(val string) bool {
+	for _, rangeStr := range strings.Split(val, ",") {
+		for _, day := range strings.Split(rangeStr, "-") {
+			if _, ok := scheduleWeekdays[strings.ToLower(day)]; !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
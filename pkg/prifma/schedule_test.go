@@ -0,0 +1,158 @@
+package prifma
+
+import (
+	"testing"
+	"time"
+)
+
+// days of the test week: 2026-10-19 is Monday, 2026-10-25 is Sunday
+func parseTestScheduleTime(t *testing.T, val string) time.Time {
+	t.Helper()
+
+	now, err := time.Parse("2006-01-02 15:04", val)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return now
+}
+
+func TestScheduleWindowsContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		now      string
+		want     bool
+	}{
+		{name: "weekday range", schedule: "mon-fri 09:00-18:00 UTC", now: "2026-10-21 12:00", want: true},
+		{name: "weekday range first day", schedule: "mon-fri 09:00-18:00 UTC", now: "2026-10-19 09:00", want: true},
+		{name: "weekday range last day", schedule: "mon-fri 09:00-18:00 UTC", now: "2026-10-23 17:59", want: true},
+		{name: "weekday range end is excluded", schedule: "mon-fri 09:00-18:00 UTC", now: "2026-10-23 18:00", want: false},
+		{name: "weekday range before start", schedule: "mon-fri 09:00-18:00 UTC", now: "2026-10-19 08:59", want: false},
+		{name: "weekday range other day", schedule: "mon-fri 09:00-18:00 UTC", now: "2026-10-24 12:00", want: false},
+		{name: "weekday range over sunday", schedule: "fri-mon UTC", now: "2026-10-25 12:00", want: true},
+		{name: "weekday range over sunday last day", schedule: "fri-mon UTC", now: "2026-10-26 23:59", want: true},
+		{name: "weekday range over sunday other day", schedule: "fri-mon UTC", now: "2026-10-21 12:00", want: false},
+		{name: "weekday list", schedule: "mon,wed UTC", now: "2026-10-21 00:00", want: true},
+		{name: "weekday list other day", schedule: "mon,wed UTC", now: "2026-10-20 12:00", want: false},
+		{name: "weekday names ignore case", schedule: "Sat-Sun UTC", now: "2026-10-24 12:00", want: true},
+		{name: "several time ranges", schedule: "08:00-09:00,12:00-13:00 UTC", now: "2026-10-20 12:30", want: true},
+		{name: "between time ranges", schedule: "08:00-09:00,12:00-13:00 UTC", now: "2026-10-20 10:00", want: false},
+		{name: "overnight start day", schedule: "fri 22:00-06:00 UTC", now: "2026-10-23 23:00", want: true},
+		{name: "overnight next day", schedule: "fri 22:00-06:00 UTC", now: "2026-10-24 05:59", want: true},
+		{name: "overnight end is excluded", schedule: "fri 22:00-06:00 UTC", now: "2026-10-24 06:00", want: false},
+		{name: "overnight before start", schedule: "fri 22:00-06:00 UTC", now: "2026-10-23 21:59", want: false},
+		{name: "overnight morning of start day", schedule: "fri 22:00-06:00 UTC", now: "2026-10-23 05:00", want: false},
+		{name: "overnight evening of next day", schedule: "fri 22:00-06:00 UTC", now: "2026-10-24 23:00", want: false},
+		{name: "overnight from sunday", schedule: "sun 23:00-01:00 UTC", now: "2026-10-26 00:30", want: true},
+		{name: "equal start and end is the whole day", schedule: "mon 00:00-00:00 UTC", now: "2026-10-19 23:59", want: true},
+		{name: "equal start and end other day", schedule: "mon 00:00-00:00 UTC", now: "2026-10-20 00:00", want: false},
+		{name: "equal start and end from the start", schedule: "mon 12:00-12:00 UTC", now: "2026-10-20 11:59", want: true},
+		{name: "end of day", schedule: "mon 20:00-24:00 UTC", now: "2026-10-19 23:59", want: true},
+		{name: "end of day next day", schedule: "mon 20:00-24:00 UTC", now: "2026-10-20 00:00", want: false},
+		{name: "only timezone is always", schedule: "UTC", now: "2026-10-22 03:04", want: true},
+		{name: "timezone", schedule: "mon 09:00-10:00 Europe/Moscow", now: "2026-10-19 06:30", want: true},
+		{name: "timezone utc time", schedule: "mon 09:00-10:00 Europe/Moscow", now: "2026-10-19 09:30", want: false},
+		{name: "timezone previous utc day", schedule: "mon 01:00-02:00 Asia/Tokyo", now: "2026-10-18 16:30", want: true},
+		{name: "timezone next utc day", schedule: "sun 20:00-21:00 America/New_York", now: "2026-10-26 00:30", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := NewScheduleWindows(test.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := schedule.Contains(parseTestScheduleTime(t, test.now)); got != test.want {
+				t.Errorf("Contains(%s) = %v, want %v", test.now, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleWindowsError(t *testing.T) {
+	tests := []string{
+		"mon 25:00-26:00",
+		"mon 09:60-10:00",
+		"mon 09:00",
+		"mon 09-10",
+		"mon 24:01-01:00",
+		"mon-foo 09:00-10:00",
+		"Europe/Nowhere",
+	}
+
+	for _, schedule := range tests {
+		t.Run(schedule, func(t *testing.T) {
+			if _, err := NewScheduleWindows(schedule); err == nil {
+				t.Errorf("NewScheduleWindows(%s) returned no error", schedule)
+			}
+		})
+	}
+}
+
+func TestScheduleCronContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		now      string
+		want     bool
+	}{
+		{name: "every minute", schedule: "TZ=UTC * * * * *", now: "2026-10-19 12:34", want: true},
+		{name: "step", schedule: "TZ=UTC */15 * * * *", now: "2026-10-19 12:45", want: true},
+		{name: "step other minute", schedule: "TZ=UTC */15 * * * *", now: "2026-10-19 12:46", want: false},
+		{name: "step from value", schedule: "TZ=UTC 5/20 * * * *", now: "2026-10-19 12:45", want: true},
+		{name: "hour range", schedule: "TZ=UTC * 9-17 * * *", now: "2026-10-19 17:59", want: true},
+		{name: "hour range end", schedule: "TZ=UTC * 9-17 * * *", now: "2026-10-19 18:00", want: false},
+		{name: "weekday range", schedule: "TZ=UTC * * * * mon-fri", now: "2026-10-23 12:00", want: true},
+		{name: "weekday range other day", schedule: "TZ=UTC * * * * mon-fri", now: "2026-10-24 12:00", want: false},
+		{name: "sunday as 7", schedule: "TZ=UTC * * * * 7", now: "2026-10-25 12:00", want: true},
+		{name: "sunday as 0", schedule: "TZ=UTC * * * * 0", now: "2026-10-25 12:00", want: true},
+		{name: "month name", schedule: "TZ=UTC * * * oct *", now: "2026-10-25 12:00", want: true},
+		{name: "other month", schedule: "TZ=UTC * * * nov *", now: "2026-10-25 12:00", want: false},
+		{name: "day of month", schedule: "TZ=UTC * * 19 * *", now: "2026-10-19 12:00", want: true},
+		{name: "day or weekday by day", schedule: "TZ=UTC * * 19 * fri", now: "2026-10-19 12:00", want: true},
+		{name: "day or weekday by weekday", schedule: "TZ=UTC * * 1 * fri", now: "2026-10-23 12:00", want: true},
+		{name: "day or weekday neither", schedule: "TZ=UTC * * 1 * fri", now: "2026-10-22 12:00", want: false},
+		{name: "timezone", schedule: "TZ=Europe/Moscow * 9 * * *", now: "2026-10-19 06:30", want: true},
+		{name: "timezone utc time", schedule: "TZ=Europe/Moscow * 9 * * *", now: "2026-10-19 09:30", want: false},
+		{name: "timezone weekday", schedule: "CRON_TZ=Asia/Tokyo * * * * mon", now: "2026-10-18 16:30", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := NewScheduleCron(test.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := schedule.Contains(parseTestScheduleTime(t, test.now)); got != test.want {
+				t.Errorf("Contains(%s) = %v, want %v", test.now, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleCronError(t *testing.T) {
+	tests := []string{
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* 17-9 * * *",
+		"*/0 * * * *",
+		"* * * * foo",
+		"TZ=Europe/Nowhere * * * * *",
+	}
+
+	for _, schedule := range tests {
+		t.Run(schedule, func(t *testing.T) {
+			if _, err := NewScheduleCron(schedule); err == nil {
+				t.Errorf("NewScheduleCron(%s) returned no error", schedule)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ type Server interface {
 	GetReadHeaderTimeout() time.Duration
 	GetWriteTimeout() time.Duration
 	GetIdleTimeout() time.Duration
+	GetMetricsAddr() string
 
 	SetListenIp(ip string) error
 	SetListenPort(port string) error
@@ -38,6 +39,7 @@ type Server interface {
 	SetReadHeaderTimeout(timeout string) error
 	SetWriteTimeout(timeout string) error
 	SetIdleTimeout(timeout string) error
+	SetMetricsAddr(addr string) error
 
 	LoadConfig(filename string) error
 	ListenAndServe() error
@@ -65,7 +67,8 @@ type DefaultServer struct {
 	DebugLog       *log.Logger
 	CertFile       string
 	KeyFile        string
-	Config         conf.Block
+	MetricsAddr    string
+	Config         *ConfigMain
 	Server         http.Server
 }
 
@@ -123,6 +126,10 @@ func (t *DefaultServer) GetIdleTimeout() time.Duration {
 	return t.Server.IdleTimeout
 }
 
+func (t *DefaultServer) GetMetricsAddr() string {
+	return t.MetricsAddr
+}
+
 func (t *DefaultServer) SetListenIp(ip string) error {
 	if net.ParseIP(ip) == nil {
 		return fmt.Errorf("invalid ip - %s", ip)
@@ -173,6 +180,8 @@ func (t *DefaultServer) SetErrorLog(filename string) error {
 	}
 
 	t.ErrorLog = log.New(file, "", log.Ldate|log.Ltime|log.Lmicroseconds)
+	DefaultConditionFiles.SetErrorLog(t.ErrorLog)
+	DefaultUserGroups.SetErrorLog(t.ErrorLog)
 
 	return nil
 }
@@ -232,11 +241,35 @@ func (t *DefaultServer) SetIdleTimeout(timeout string) error {
 	return nil
 }
 
+func (t *DefaultServer) SetMetricsAddr(addr string) error {
+	if addr == "off" {
+		t.MetricsAddr = ""
+
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid metrics address - %s", addr)
+	}
+
+	t.MetricsAddr = addr
+
+	return nil
+}
+
 func (t *DefaultServer) LoadConfig(filename string) error {
-	return conf.DefaultDecoder.Decode(t.Config, filename)
+	if err := conf.DefaultDecoder.Decode(t.Config, filename); err != nil {
+		return err
+	}
+
+	return t.Config.Check()
 }
 
 func (t *DefaultServer) ListenAndServe() error {
+	if t.MetricsAddr != "" {
+		go t.ListenAndServeMetrics()
+	}
+
 	switch t.ListenType {
 	case ListenTypeHttp:
 		return t.Server.ListenAndServe()
@@ -246,3 +279,12 @@ func (t *DefaultServer) ListenAndServe() error {
 		return fmt.Errorf("unavailable listen type - %v", t.ListenType)
 	}
 }
+
+func (t *DefaultServer) ListenAndServeMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/", Metrics)
+
+	if err := http.ListenAndServe(t.MetricsAddr, mux); err != nil {
+		t.ErrorLog.Println(err)
+	}
+}
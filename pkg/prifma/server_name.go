@@ -0,0 +1,19 @@
+package prifma
+
+import (
+	"context"
+	"net/http"
+)
+
+type serverNameContextKey struct{}
+
+// WithServerName saves the server name (TLS SNI) of the tunnel to the request context
+func WithServerName(ctx context.Context, serverName string) context.Context {
+	return context.WithValue(ctx, serverNameContextKey{}, serverName)
+}
+
+func GetServerName(req *http.Request) string {
+	serverName, _ := req.Context().Value(serverNameContextKey{}).(string)
+
+	return serverName
+}
@@ -0,0 +1,57 @@
+package tunnel
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// PrereadConn is the client connection with already read (peeked) data
+type PrereadConn struct {
+	net.Conn
+	Reader io.Reader
+}
+
+func NewPrereadConn(conn net.Conn, reader io.Reader) *PrereadConn {
+	return &PrereadConn{
+		Conn:   conn,
+		Reader: reader,
+	}
+}
+
+func (t *PrereadConn) Read(b []byte) (int, error) {
+	return t.Reader.Read(b)
+}
+
+// PrereadResponseWriter replaces http.ResponseWriter after "200 OK" was sent to the client.
+// Any other status closes the connection, the body is discarded.
+type PrereadResponseWriter struct {
+	Conn      net.Conn
+	HeaderMap http.Header
+}
+
+func NewPrereadResponseWriter(conn net.Conn) *PrereadResponseWriter {
+	return &PrereadResponseWriter{
+		Conn:      conn,
+		HeaderMap: make(http.Header),
+	}
+}
+
+func (t *PrereadResponseWriter) Header() http.Header {
+	return t.HeaderMap
+}
+
+func (t *PrereadResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (t *PrereadResponseWriter) WriteHeader(statusCode int) {
+	if statusCode != http.StatusOK {
+		_ = t.Conn.Close()
+	}
+}
+
+func (t *PrereadResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return t.Conn, bufio.NewReadWriter(bufio.NewReader(t.Conn), bufio.NewWriter(t.Conn)), nil
+}
@@ -1,20 +1,32 @@
 package tunnel
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"github.com/topvisor/go-prifma/pkg/prifma"
 	"github.com/topvisor/go-prifma/pkg/utils"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"time"
+)
+
+const (
+	PrereadTimeout = time.Second * 5
+	// PrereadFirstByteTimeout limits waiting for the first data of the client,
+	// clients of protocols where the server speaks first (e.g. SMTP, SSH) send nothing until the tunnel is opened
+	PrereadFirstByteTimeout = time.Second
 )
 
 type ResponseTunnel struct {
 	ResponseCode int
 	DstConn      net.Conn
+	Preread      bool
 }
 
 func NewResponseTunnel() *ResponseTunnel {
@@ -42,6 +54,8 @@ func (t *ResponseTunnel) Write(rw http.ResponseWriter, result prifma.HandleReque
 		}
 	}
 
+	prifma.SetOutgoingIpHeader(rw.Header(), result, t.GetLAddr())
+
 	rw.WriteHeader(http.StatusOK)
 	t.ResponseCode = http.StatusOK
 
@@ -69,6 +83,62 @@ func (t *ResponseTunnel) Write(rw http.ResponseWriter, result prifma.HandleReque
 	return nil
 }
 
+// Rehandle sends "200 OK" and reads TLS ClientHello before the tunnel is opened to get the server name (SNI)
+func (t *ResponseTunnel) Rehandle(rw http.ResponseWriter, result prifma.HandleRequestResult) (http.ResponseWriter, *http.Request, error) {
+	if !t.Preread {
+		return nil, nil, nil
+	}
+
+	rw.WriteHeader(http.StatusOK)
+
+	clientConn, clientRw, err := rw.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timeout := result.GetServer().GetReadHeaderTimeout()
+	if timeout == 0 {
+		timeout = PrereadTimeout
+	}
+
+	firstByteTimeout := PrereadFirstByteTimeout
+	if timeout < firstByteTimeout {
+		firstByteTimeout = timeout
+	}
+
+	// errors of reading by the hijacked reader cancel the request context, so only its buffered data is used
+	var clientReader io.Reader = clientConn
+	if buffered := clientRw.Reader.Buffered(); buffered != 0 {
+		data, _ := clientRw.Reader.Peek(buffered)
+		clientReader = io.MultiReader(bytes.NewReader(data), clientConn)
+	}
+
+	reader := bufio.NewReaderSize(clientReader, utils.TlsRecordMaxSize)
+	serverName := ""
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(firstByteTimeout))
+	if _, err = reader.Peek(1); err == nil {
+		_ = clientConn.SetReadDeadline(time.Now().Add(timeout))
+		serverName, err = utils.PeekTlsServerName(reader)
+	}
+	_ = clientConn.SetReadDeadline(time.Time{})
+
+	rw = NewPrereadResponseWriter(NewPrereadConn(clientConn, reader))
+
+	if err != nil || serverName == "" {
+		if netErr, ok := err.(net.Error); err == utils.ErrNotTls || ok && netErr.Timeout() {
+			err = nil
+		}
+
+		return rw, nil, err
+	}
+
+	req := result.GetRequest()
+	req = req.WithContext(prifma.WithServerName(req.Context(), serverName))
+
+	return rw, req, nil
+}
+
 func (t *ResponseTunnel) GetCode() int {
 	return t.ResponseCode
 }
@@ -151,5 +221,9 @@ func (t *ResponseTunnel) ConnectToRequest(result prifma.HandleRequestResult) err
 
 	t.DstConn, err = result.GetDialer().DialContext(ctx, network, addr)
 
+	if err == nil || ctx.Err() == nil {
+		prifma.ReportOutgoingIpHealth(result, t.GetLAddr(), err == nil)
+	}
+
 	return err
 }
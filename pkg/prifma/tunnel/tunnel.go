@@ -6,9 +6,13 @@ import (
 	"net/http"
 )
 
-const ModuleDirective = "tunnel"
+const (
+	ModuleDirective        = "tunnel"
+	ModuleDirectivePreread = "ssl_preread"
+)
 
 type Tunnel struct {
+	Preread bool
 }
 
 func New() *Tunnel {
@@ -16,25 +20,69 @@ func New() *Tunnel {
 }
 
 func (t *Tunnel) HandleRequest(result prifma.HandleRequestResult) (prifma.HandleRequestResult, error) {
-	if result.GetRequest().Method == http.MethodConnect {
-		result.SetResponse(NewResponseTunnel())
+	if result.GetRequest().Method != http.MethodConnect {
+		return result, nil
+	}
+
+	if result.GetAccess() == prifma.AccessDenied {
+		result.SetResponse(prifma.NewResponseError(http.StatusForbidden, ""))
+
+		return result, nil
 	}
 
+	response := NewResponseTunnel()
+	response.Preread = t.Preread
+
+	result.SetResponse(response)
+
 	return result, nil
 }
 
+func (t *Tunnel) SetPreread(preread bool) error {
+	t.Preread = preread
+
+	return nil
+}
+
 func (t *Tunnel) GetDirective() string {
 	return ModuleDirective
 }
 
+func (t *Tunnel) GetDirectives() []string {
+	return []string{ModuleDirective, ModuleDirectivePreread}
+}
+
 func (t *Tunnel) Clone() prifma.Module {
-	return t
+	clone := *t
+
+	return &clone
 }
 
 func (t *Tunnel) Call(command conf.Command) error {
-	return conf.NewErrCommandName(command)
+	if command.GetName() != ModuleDirectivePreread {
+		return conf.NewErrCommandName(command)
+	}
+
+	if len(command.GetArgs()) != 1 {
+		return conf.NewErrCommandArgsNumber(command)
+	}
+
+	arg := command.GetArgs()[0]
+
+	switch arg {
+	case "off":
+		return t.SetPreread(false)
+	case "on":
+		return t.SetPreread(true)
+	}
+
+	return conf.NewErrCommandArg(command, arg)
 }
 
 func (t *Tunnel) CallBlock(command conf.Command) (conf.Block, error) {
-	return nil, conf.NewErrCommandName(command)
+	if command.GetName() != ModuleDirectivePreread {
+		return nil, conf.NewErrCommandName(command)
+	}
+
+	return nil, conf.NewErrCommandMustHaveNoBlock(command)
 }
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"github.com/topvisor/go-prifma/pkg/conf"
 	"github.com/topvisor/go-prifma/pkg/prifma"
+	"github.com/topvisor/go-prifma/pkg/prifma/outgoingip"
+	"github.com/topvisor/go-prifma/pkg/utils"
 	"net"
 	"net/http"
+	"strings"
 )
 
 const (
@@ -14,7 +17,10 @@ const (
 )
 
 type UseIpHeader struct {
-	Enabled bool
+	Enabled          bool
+	AllowedIps       *utils.IpTree   // nil - ips of "outgoing_ip" are allowed
+	AllowedAddresses map[string]bool // allowed ips defined without networks
+	AllowedPools     map[string]*outgoingip.Pool
 }
 
 func New() *UseIpHeader {
@@ -31,6 +37,17 @@ func (t *UseIpHeader) HandleRequest(result prifma.HandleRequestResult) (prifma.H
 		return result, nil
 	}
 
+	if strings.HasPrefix(ipStr, outgoingip.PoolPrefix) {
+		pool, ok := t.AllowedPools[ipStr[len(outgoingip.PoolPrefix):]]
+		if !ok {
+			result.SetResponse(prifma.NewResponseError(http.StatusForbidden, fmt.Sprintf("outgoing ip pool is not allowed: '%s'", ipStr)))
+
+			return result, nil
+		}
+
+		return result, outgoingip.ApplyPool(result, pool)
+	}
+
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		result.SetResponse(prifma.NewResponseError(http.StatusBadRequest, fmt.Sprintf("wrong outgoing ip: '%s'", ipStr)))
@@ -38,6 +55,12 @@ func (t *UseIpHeader) HandleRequest(result prifma.HandleRequestResult) (prifma.H
 		return result, nil
 	}
 
+	if !t.IsAllowed(result, ip) {
+		result.SetResponse(prifma.NewResponseError(http.StatusForbidden, fmt.Sprintf("outgoing ip is not allowed: '%s'", ipStr)))
+
+		return result, nil
+	}
+
 	result.GetDialer().SetIpV4(nil)
 	result.GetDialer().SetIpV6(nil)
 
@@ -47,17 +70,72 @@ func (t *UseIpHeader) HandleRequest(result prifma.HandleRequestResult) (prifma.H
 		result.GetDialer().SetIpV6(ip)
 	}
 
+	// ips of networks and ranges may be not assigned to the interface
+	result.GetDialer().SetFreeBind(!t.IsAddress(result, ip))
+	result.GetDialer().SetRandomIp(false)
+
+	outgoingip.FixIps(result)
+
 	return result, nil
 }
 
+// IsAllowed checks the ip by the allowed ips, or by ips of "outgoing_ip" if allowed ips are not defined
+func (t *UseIpHeader) IsAllowed(result prifma.HandleRequestResult, ip net.IP) bool {
+	if t.AllowedIps != nil {
+		return t.AllowedIps.Contains(ip)
+	}
+
+	outgoingIps := result.GetOutgoingIps()
+
+	return outgoingIps != nil && outgoingIps.Contains(ip)
+}
+
+// IsAddress returns true if the ip is defined as the single ip (not in the network or the range)
+func (t *UseIpHeader) IsAddress(result prifma.HandleRequestResult, ip net.IP) bool {
+	if t.AllowedIps != nil {
+		return t.AllowedAddresses[ip.String()]
+	}
+
+	selection, ok := result.GetOutgoingIps().(*outgoingip.Selection)
+
+	return ok && selection.Pool.ContainsAddress(ip)
+}
+
 func (t *UseIpHeader) Off() error {
 	t.Enabled = false
 
 	return nil
 }
 
-func (t *UseIpHeader) On() error {
+// On enables the header, allowed values: ips, networks (CIDR) and pools ("pool:name")
+func (t *UseIpHeader) On(allowed []string) error {
 	t.Enabled = true
+	t.AllowedIps = nil
+	t.AllowedAddresses = make(map[string]bool)
+	t.AllowedPools = make(map[string]*outgoingip.Pool)
+
+	for _, val := range allowed {
+		pool, err := outgoingip.DefaultPools.GetByValue(val)
+		if err != nil {
+			return err
+		}
+
+		if pool != nil {
+			t.AllowedPools[pool.Name] = pool
+
+			continue
+		}
+
+		if t.AllowedIps == nil {
+			t.AllowedIps = utils.NewIpTree()
+		}
+		if err = t.AllowedIps.AddString(val); err != nil {
+			return fmt.Errorf("wrong allowed ip - '%s'", val)
+		}
+		if ip := net.ParseIP(val); ip != nil {
+			t.AllowedAddresses[ip.String()] = true
+		}
+	}
 
 	return nil
 }
@@ -77,20 +155,23 @@ func (t *UseIpHeader) Call(command conf.Command) error {
 		return conf.NewErrCommandName(command)
 	}
 
-	if len(command.GetArgs()) != 1 {
+	args := command.GetArgs()
+	if len(args) == 0 || args[0] == "off" && len(args) != 1 {
 		return conf.NewErrCommandArgsNumber(command)
 	}
 
-	arg := command.GetArgs()[0]
-
-	switch arg {
+	switch args[0] {
 	case "off":
 		return t.Off()
 	case "on":
-		return t.On()
+		if err := t.On(args[1:]); err != nil {
+			return conf.NewErrCommand(command, err.Error())
+		}
+
+		return nil
 	}
 
-	return conf.NewErrCommandArg(command, arg)
+	return conf.NewErrCommandArg(command, args[0])
 }
 
 func (t *UseIpHeader) CallBlock(command conf.Command) (conf.Block, error) {
@@ -0,0 +1,120 @@
+package prifma
+
+import (
+	"fmt"
+	"github.com/topvisor/go-prifma/pkg/utils"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+var DefaultUserGroups = NewUserGroups()
+
+type UserGroups interface {
+	LoadGroupsFile(filename string) error
+	GetUserGroups(user string) []string
+	Off() error
+}
+
+func NewUserGroups() *FileUserGroups {
+	return &FileUserGroups{
+		Groups:   make(map[string][]string),
+		ErrorLog: log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lmicroseconds),
+		RWMutex:  new(sync.RWMutex),
+	}
+}
+
+// FileUserGroups loads groups from the file (reloaded on change), line format: "group: user1 user2 ...".
+// Reload errors are written to ErrorLog, the previous groups are kept.
+type FileUserGroups struct {
+	Groups   map[string][]string
+	ErrorLog *log.Logger
+	RWMutex  *sync.RWMutex
+	Watcher  *utils.FileWatcher
+}
+
+// LoadGroupsFile replaces groups by groups of the file
+func (t *FileUserGroups) LoadGroupsFile(filename string) error {
+	if err := t.Off(); err != nil {
+		return err
+	}
+
+	watcher, err := utils.WatchFile(filename, t.Load)
+	if err != nil {
+		return fmt.Errorf("can't load groups file: '%s' (%v)", filename, err)
+	}
+
+	watcher.SetErrorHandler(func(err error) {
+		t.RWMutex.RLock()
+		errorLog := t.ErrorLog
+		t.RWMutex.RUnlock()
+
+		errorLog.Printf("can't reload groups file: '%s' (%v)", filename, err)
+	})
+
+	t.RWMutex.Lock()
+	t.Watcher = watcher
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+// Off stops watching the file and removes groups
+func (t *FileUserGroups) Off() error {
+	t.RWMutex.Lock()
+	watcher := t.Watcher
+	t.Watcher = nil
+	t.RWMutex.Unlock()
+
+	// the watcher may be reloading the file
+	if watcher != nil {
+		watcher.Stop()
+	}
+
+	t.RWMutex.Lock()
+	t.Groups = make(map[string][]string)
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+func (t *FileUserGroups) SetErrorLog(errorLog *log.Logger) {
+	t.RWMutex.Lock()
+	defer t.RWMutex.Unlock()
+
+	t.ErrorLog = errorLog
+}
+
+func (t *FileUserGroups) Load(filename string) error {
+	lines, err := utils.ReadFileLines(filename)
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[string][]string)
+	for _, line := range lines {
+		i := strings.IndexByte(line, ':')
+		if i < 1 {
+			return fmt.Errorf("wrong format of groups file: '%s'", filename)
+		}
+
+		group := strings.TrimSpace(line[:i])
+		for _, user := range strings.Fields(line[i+1:]) {
+			groups[user] = append(groups[user], group)
+		}
+	}
+
+	t.RWMutex.Lock()
+	t.Groups = groups
+	t.RWMutex.Unlock()
+
+	return nil
+}
+
+func (t *FileUserGroups) GetUserGroups(user string) []string {
+	t.RWMutex.RLock()
+	defer t.RWMutex.RUnlock()
+
+	return t.Groups[user]
+}
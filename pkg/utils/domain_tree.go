@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"strings"
+)
+
+// DomainTree is a trie of domain labels (from the top level domain).
+// Supported domains:
+// 1. example.com - the domain only
+// 2. *.example.com - all subdomains of the domain
+// 3. .example.com - the domain and all its subdomains
+type DomainTree struct {
+	Children      map[string]*DomainTree
+	Value         interface{}
+	HasValue      bool
+	WildcardValue interface{}
+	HasWildcard   bool
+}
+
+func NewDomainTree() *DomainTree {
+	return &DomainTree{
+		Children: make(map[string]*DomainTree),
+	}
+}
+
+func (t *DomainTree) Add(domain string, value interface{}) {
+	domain = NormalizeDomain(domain)
+
+	isDomain := true
+	isWildcard := false
+
+	switch true {
+	case domain == "*":
+		domain = ""
+		isDomain = false
+		isWildcard = true
+	case strings.HasPrefix(domain, "*."):
+		domain = domain[2:]
+		isDomain = false
+		isWildcard = true
+	case strings.HasPrefix(domain, "."):
+		domain = domain[1:]
+		isWildcard = true
+	}
+
+	node := t
+	if domain != "" {
+		labels := strings.Split(domain, ".")
+		for i := len(labels) - 1; i >= 0; i-- {
+			child := node.Children[labels[i]]
+			if child == nil {
+				child = NewDomainTree()
+				node.Children[labels[i]] = child
+			}
+
+			node = child
+		}
+	}
+
+	if isDomain {
+		node.Value = value
+		node.HasValue = true
+	}
+	if isWildcard {
+		node.WildcardValue = value
+		node.HasWildcard = true
+	}
+}
+
+// Get returns the value of the most specific matched domain
+func (t *DomainTree) Get(domain string) (interface{}, bool) {
+	domain = NormalizeDomain(domain)
+	if domain == "" {
+		return nil, false
+	}
+
+	var value interface{}
+	var ok bool
+
+	node := t
+	labels := strings.Split(domain, ".")
+
+	for i := len(labels) - 1; i >= 0; i-- {
+		if node.HasWildcard {
+			value = node.WildcardValue
+			ok = true
+		}
+
+		if node = node.Children[labels[i]]; node == nil {
+			return value, ok
+		}
+	}
+
+	if node.HasValue {
+		return node.Value, true
+	}
+
+	return value, ok
+}
+
+func (t *DomainTree) Contains(domain string) bool {
+	_, ok := t.Get(domain)
+
+	return ok
+}
+
+func NormalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
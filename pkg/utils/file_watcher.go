@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+const FileWatcherInterval = time.Second * 5
+
+type FileLoader func(filename string) error
+
+// FileWatcher calls Loader every time the file is changed (mtime polling).
+// Reload errors are passed to ErrorHandler if it is set, otherwise kept until PopError is called,
+// previous data should be kept by Loader.
+type FileWatcher struct {
+	Filename     string
+	Loader       FileLoader
+	ModTime      time.Time
+	Size         int64
+	Err          error
+	ErrorHandler func(err error)
+	Mutex        *sync.Mutex
+	Done         chan struct{}
+}
+
+func WatchFile(filename string, loader FileLoader) (*FileWatcher, error) {
+	t := &FileWatcher{
+		Filename: filename,
+		Loader:   loader,
+		Mutex:    new(sync.Mutex),
+		Done:     make(chan struct{}),
+	}
+
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+
+	go t.watch()
+
+	return t, nil
+}
+
+func (t *FileWatcher) Reload() error {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	if t.isStopped() {
+		return nil
+	}
+
+	stat, err := os.Stat(t.Filename)
+	if err != nil {
+		return err
+	}
+
+	if stat.ModTime().Equal(t.ModTime) && stat.Size() == t.Size {
+		return nil
+	}
+
+	t.ModTime = stat.ModTime()
+	t.Size = stat.Size()
+
+	return t.Loader(t.Filename)
+}
+
+func (t *FileWatcher) PopError() error {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	err := t.Err
+	t.Err = nil
+
+	return err
+}
+
+// SetErrorHandler sets the handler of reload errors, it is called by the watching goroutine
+func (t *FileWatcher) SetErrorHandler(handler func(err error)) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	t.ErrorHandler = handler
+}
+
+// Stop stops watching the file, Loader isn't called after Stop returns
+func (t *FileWatcher) Stop() {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	if !t.isStopped() {
+		close(t.Done)
+	}
+}
+
+func (t *FileWatcher) isStopped() bool {
+	select {
+	case <-t.Done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *FileWatcher) watch() {
+	ticker := time.NewTicker(FileWatcherInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.Done:
+			return
+		}
+
+		if err := t.Reload(); err != nil {
+			t.Mutex.Lock()
+			handler := t.ErrorHandler
+			if handler == nil {
+				t.Err = err
+			}
+			t.Mutex.Unlock()
+
+			if handler != nil {
+				handler(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IpTree is a binary radix tree of networks, IPv4 networks are stored as IPv4-mapped IPv6 networks
+type IpTree struct {
+	Children [2]*IpTree
+	IsNet    bool
+}
+
+func NewIpTree() *IpTree {
+	return new(IpTree)
+}
+
+func (t *IpTree) Add(ipNet *net.IPNet) {
+	ones, bits := ipNet.Mask.Size()
+	ip := ipNet.IP.To16()
+	if bits == net.IPv4len*8 {
+		ones += (net.IPv6len - net.IPv4len) * 8
+	}
+
+	node := t
+	for i := 0; i < ones; i++ {
+		if node.IsNet {
+			return
+		}
+
+		bit := ip[i/8] >> uint(7-i%8) & 1
+		if node.Children[bit] == nil {
+			node.Children[bit] = NewIpTree()
+		}
+
+		node = node.Children[bit]
+	}
+
+	node.IsNet = true
+	node.Children = [2]*IpTree{}
+}
+
+// AddString adds the network in CIDR notation or the single ip
+func (t *IpTree) AddString(cidr string) error {
+	if !strings.ContainsRune(cidr, '/') {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return fmt.Errorf("wrong ip - '%s'", cidr)
+		}
+
+		if ipV4 := ip.To4(); ipV4 != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+
+	t.Add(ipNet)
+
+	return nil
+}
+
+func (t *IpTree) Contains(ip net.IP) bool {
+	if ip = ip.To16(); ip == nil {
+		return false
+	}
+
+	node := t
+	for i := 0; i < net.IPv6len*8; i++ {
+		if node.IsNet {
+			return true
+		}
+
+		if node = node.Children[ip[i/8]>>uint(7-i%8)&1]; node == nil {
+			return false
+		}
+	}
+
+	return node.IsNet
+}
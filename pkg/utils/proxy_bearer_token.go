@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ProxyBearerToken returns token from "Proxy-Authorization: Bearer ..." or JWT passed as "Basic" password
+func ProxyBearerToken(req *http.Request) (token string, ok bool) {
+	auth := req.Header.Get("Proxy-Authorization")
+
+	const prefix = "Bearer "
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):]), true
+	}
+
+	if _, password, ok := ProxyBasicAuth(req); ok && strings.Count(password, ".") == 2 {
+		return password, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ReadFileLines returns trimmed lines of the file, empty lines and comments (#) are skipped
+func ReadFileLines(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer CloseFile(file)
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
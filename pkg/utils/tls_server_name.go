@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+)
+
+const (
+	TlsRecordHeaderSize = 5
+	TlsRecordMaxSize    = TlsRecordHeaderSize + 16384
+)
+
+var (
+	ErrNotTls              = errors.New("not a TLS handshake")
+	ErrWrongTlsClientHello = errors.New("wrong TLS ClientHello")
+)
+
+// PeekTlsServerName returns server name (SNI) from ClientHello without consuming data of the reader.
+// Size of the reader buffer must be at least TlsRecordMaxSize.
+func PeekTlsServerName(reader *bufio.Reader) (string, error) {
+	header, err := reader.Peek(TlsRecordHeaderSize)
+	if err != nil {
+		return "", err
+	}
+	if header[0] != 0x16 {
+		return "", ErrNotTls
+	}
+
+	recordSize := TlsRecordHeaderSize + (int(header[3])<<8 | int(header[4]))
+	if recordSize > TlsRecordMaxSize {
+		return "", ErrWrongTlsClientHello
+	}
+
+	record, err := reader.Peek(recordSize)
+	if err != nil {
+		return "", err
+	}
+
+	return ParseTlsServerName(record[TlsRecordHeaderSize:])
+}
+
+// ParseTlsServerName returns server name (SNI) from ClientHello handshake message
+func ParseTlsServerName(data []byte) (string, error) {
+	// handshake type (1) + length (3) + version (2) + random (32)
+	if len(data) < 38 || data[0] != 0x01 {
+		return "", ErrWrongTlsClientHello
+	}
+
+	data = data[38:]
+
+	// session id
+	data, ok := skipTlsVector(data, 1)
+	if !ok {
+		return "", ErrWrongTlsClientHello
+	}
+	// cipher suites
+	if data, ok = skipTlsVector(data, 2); !ok {
+		return "", ErrWrongTlsClientHello
+	}
+	// compression methods
+	if data, ok = skipTlsVector(data, 1); !ok {
+		return "", ErrWrongTlsClientHello
+	}
+	// no extensions
+	if len(data) < 2 {
+		return "", nil
+	}
+
+	extensionsSize := int(data[0])<<8 | int(data[1])
+	data = data[2:]
+	if len(data) > extensionsSize {
+		data = data[:extensionsSize]
+	}
+
+	for len(data) >= 4 {
+		extensionType := int(data[0])<<8 | int(data[1])
+		extensionSize := int(data[2])<<8 | int(data[3])
+		data = data[4:]
+
+		if len(data) < extensionSize {
+			return "", ErrWrongTlsClientHello
+		}
+
+		if extensionType == 0x0000 {
+			return parseTlsServerNameExtension(data[:extensionSize])
+		}
+
+		data = data[extensionSize:]
+	}
+
+	return "", nil
+}
+
+func parseTlsServerNameExtension(data []byte) (string, error) {
+	if len(data) < 2 {
+		return "", ErrWrongTlsClientHello
+	}
+
+	data = data[2:]
+
+	for len(data) >= 3 {
+		nameType := data[0]
+		nameSize := int(data[1])<<8 | int(data[2])
+		data = data[3:]
+
+		if len(data) < nameSize {
+			return "", ErrWrongTlsClientHello
+		}
+
+		if nameType == 0x00 {
+			return string(data[:nameSize]), nil
+		}
+
+		data = data[nameSize:]
+	}
+
+	return "", nil
+}
+
+func skipTlsVector(data []byte, lengthSize int) ([]byte, bool) {
+	if len(data) < lengthSize {
+		return nil, false
+	}
+
+	size := 0
+	for i := 0; i < lengthSize; i++ {
+		size = size<<8 | int(data[i])
+	}
+
+	if len(data) < lengthSize+size {
+		return nil, false
+	}
+
+	return data[lengthSize+size:], true
+}
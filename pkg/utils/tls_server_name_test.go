@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+// readTestClientHello returns the TLS record with ClientHello sent by crypto/tls
+func readTestClientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+
+	go func() {
+		client := tls.Client(clientConn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		_ = client.Handshake()
+		_ = clientConn.Close()
+	}()
+
+	header := make([]byte, TlsRecordHeaderSize)
+	if _, err := io.ReadFull(serverConn, header); err != nil {
+		t.Fatal(err)
+	}
+
+	record := make([]byte, int(header[3])<<8|int(header[4]))
+	if _, err := io.ReadFull(serverConn, record); err != nil {
+		t.Fatal(err)
+	}
+
+	return append(header, record...)
+}
+
+// buildTestClientHello returns the TLS record with ClientHello of the extensions
+func buildTestClientHello(extensions []byte) []byte {
+	hello := []byte{0x03, 0x03}                   // version
+	hello = append(hello, make([]byte, 32)...)    // random
+	hello = append(hello, 0x00)                   // session id
+	hello = append(hello, 0x00, 0x02, 0x13, 0x01) // cipher suites
+	hello = append(hello, 0x01, 0x00)             // compression methods
+	if extensions != nil {
+		hello = append(hello, byte(len(extensions)>>8), byte(len(extensions)))
+		hello = append(hello, extensions...)
+	}
+
+	handshake := append([]byte{0x01, 0x00, byte(len(hello) >> 8), byte(len(hello))}, hello...)
+
+	return append([]byte{0x16, 0x03, 0x01, byte(len(handshake) >> 8), byte(len(handshake))}, handshake...)
+}
+
+// buildTestServerNameExtension returns the server name extension with names of the types
+func buildTestServerNameExtension(nameType byte, names ...string) []byte {
+	list := make([]byte, 0)
+	for _, name := range names {
+		list = append(list, nameType, byte(len(name)>>8), byte(len(name)))
+		list = append(list, name...)
+	}
+
+	data := append([]byte{byte(len(list) >> 8), byte(len(list))}, list...)
+
+	return append([]byte{0x00, 0x00, byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+func TestPeekTlsServerName(t *testing.T) {
+	// supported versions extension
+	otherExtension := []byte{0x00, 0x2b, 0x00, 0x03, 0x02, 0x03, 0x04}
+
+	tests := []struct {
+		name       string
+		data       func(t *testing.T) []byte
+		serverName string
+		err        error
+	}{
+		{
+			name: "crypto/tls client",
+			data: func(t *testing.T) []byte {
+				return readTestClientHello(t, "example.com")
+			},
+			serverName: "example.com",
+		},
+		{
+			name: "crypto/tls client without server name",
+			data: func(t *testing.T) []byte {
+				return readTestClientHello(t, "")
+			},
+		},
+		{
+			name: "crypto/tls client with ip",
+			data: func(t *testing.T) []byte {
+				return readTestClientHello(t, "127.0.0.1")
+			},
+		},
+		{
+			name: "server name after other extensions",
+			data: func(t *testing.T) []byte {
+				return buildTestClientHello(append(otherExtension, buildTestServerNameExtension(0x00, "example.org")...))
+			},
+			serverName: "example.org",
+		},
+		{
+			name: "no extensions",
+			data: func(t *testing.T) []byte {
+				return buildTestClientHello(nil)
+			},
+		},
+		{
+			name: "no server name extension",
+			data: func(t *testing.T) []byte {
+				return buildTestClientHello(otherExtension)
+			},
+		},
+		{
+			name: "other name type",
+			data: func(t *testing.T) []byte {
+				return buildTestClientHello(buildTestServerNameExtension(0x01, "example.org"))
+			},
+		},
+		{
+			name: "data after the record is not read",
+			data: func(t *testing.T) []byte {
+				return append(buildTestClientHello(buildTestServerNameExtension(0x00, "example.org")), 0x17, 0x03, 0x03)
+			},
+			serverName: "example.org",
+		},
+		{
+			name: "application data record",
+			data: func(t *testing.T) []byte {
+				return []byte{0x17, 0x03, 0x03, 0x00, 0x01, 0x00}
+			},
+			err: ErrNotTls,
+		},
+		{
+			name: "plain text",
+			data: func(t *testing.T) []byte {
+				return []byte("SSH-2.0-OpenSSH\r\n")
+			},
+			err: ErrNotTls,
+		},
+		{
+			name: "truncated header",
+			data: func(t *testing.T) []byte {
+				return []byte{0x16, 0x03, 0x01}
+			},
+			err: io.EOF,
+		},
+		{
+			name: "truncated record",
+			data: func(t *testing.T) []byte {
+				record := readTestClientHello(t, "example.com")
+
+				return record[:len(record)-10]
+			},
+			err: io.EOF,
+		},
+		{
+			name: "too long record",
+			data: func(t *testing.T) []byte {
+				return []byte{0x16, 0x03, 0x01, 0x40, 0x01}
+			},
+			err: ErrWrongTlsClientHello,
+		},
+		{
+			name: "other handshake message",
+			data: func(t *testing.T) []byte {
+				record := buildTestClientHello(nil)
+				record[TlsRecordHeaderSize] = 0x02
+
+				return record
+			},
+			err: ErrWrongTlsClientHello,
+		},
+		{
+			name: "short handshake message",
+			data: func(t *testing.T) []byte {
+				return []byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00}
+			},
+			err: ErrWrongTlsClientHello,
+		},
+		{
+			name: "wrong cipher suites length",
+			data: func(t *testing.T) []byte {
+				record := buildTestClientHello(nil)
+				record[TlsRecordHeaderSize+4+2+32+1] = 0xff
+
+				return record
+			},
+			err: ErrWrongTlsClientHello,
+		},
+		{
+			name: "wrong extension length",
+			data: func(t *testing.T) []byte {
+				return buildTestClientHello([]byte{0x00, 0x2b, 0x00, 0x10, 0x02})
+			},
+			err: ErrWrongTlsClientHello,
+		},
+		{
+			name: "wrong server name length",
+			data: func(t *testing.T) []byte {
+				return buildTestClientHello([]byte{0x00, 0x00, 0x00, 0x06, 0x00, 0x04, 0x00, 0x00, 0x10, 0x61})
+			},
+			err: ErrWrongTlsClientHello,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.data(t)
+			reader := bufio.NewReaderSize(bytes.NewReader(data), TlsRecordMaxSize)
+
+			serverName, err := PeekTlsServerName(reader)
+			if err != test.err {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			if serverName != test.serverName {
+				t.Errorf("server name = '%s', want '%s'", serverName, test.serverName)
+			}
+
+			// the data must be kept for the tunnel
+			if test.err != io.EOF {
+				if read, _ := ioutil.ReadAll(reader); !bytes.Equal(read, data) {
+					t.Errorf("data of the reader was consumed")
+				}
+			}
+		})
+	}
+}